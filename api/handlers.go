@@ -0,0 +1,384 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/IAmRiteshKoushik/termite/consumer"
+	"github.com/IAmRiteshKoushik/termite/pkg"
+)
+
+const (
+	defaultLogLimit = 50
+	maxLogLimit     = 500
+)
+
+// Time a health check waits for the store
+const healthTimeout = 2 * time.Second
+
+// webhookView is a webhook as shown by the API. Signing secrets are never
+// shown, only how many there are, and URLs only show their scheme and host.
+type webhookView struct {
+	Name          string                   `json:"name"`
+	Queue         string                   `json:"queue"`
+	Schema        string                   `json:"schema"`
+	SchemaVersion int                      `json:"schema_version"`
+	Workers       int                      `json:"workers"`
+	Prefetch      int                      `json:"prefetch"`
+	PartitionKey  string                   `json:"partition_key,omitempty"`
+	Destinations  []destinationView        `json:"destinations"`
+	Routes        []pkg.RouteConfig        `json:"routes"`
+	Retry         retryView                `json:"retry"`
+	Secrets       int                      `json:"signing_secrets"`
+	Fields        []pkg.FieldConfig        `json:"fields"`
+	Rules         []pkg.RuleConfig         `json:"rules"`
+	Transform     bool                     `json:"transform"`
+	Circuits      []consumer.CircuitStatus `json:"circuits"`
+}
+
+// destinationView shows the type of credentials a destination uses, never the
+// credentials themselves.
+type destinationView struct {
+	Name      string `json:"name"`
+	URL       string `json:"url"`
+	Transform bool   `json:"transform"`
+	Auth      string `json:"auth,omitempty"`
+}
+
+type retryView struct {
+	MaxAttempts  int     `json:"max_attempts"`
+	Unlimited    bool    `json:"unlimited"`
+	InitialDelay string  `json:"initial_delay"`
+	Multiplier   float64 `json:"multiplier"`
+	MaxDelay     string  `json:"max_delay"`
+	Jitter       float64 `json:"jitter"`
+}
+
+func newWebhookView(c *consumer.WebhookConsumer) webhookView {
+	hook := c.Config()
+	view := webhookView{
+		Name:          hook.Name,
+		Queue:         hook.Queue,
+		Schema:        hook.Schema,
+		SchemaVersion: hook.SchemaVersion,
+		Workers:       hook.Workers,
+		Prefetch:      hook.Prefetch,
+		PartitionKey:  hook.PartitionKey,
+		Destinations:  make([]destinationView, 0, len(hook.Destinations)),
+		Routes:        nonNil(hook.Routes),
+		Retry: retryView{
+			MaxAttempts:  hook.Retry.MaxAttempts,
+			Unlimited:    hook.Retry.Unlimited,
+			InitialDelay: hook.Retry.InitialDelay.String(),
+			Multiplier:   hook.Retry.Multiplier,
+			MaxDelay:     hook.Retry.MaxDelay.String(),
+			Jitter:       hook.Retry.Jitter,
+		},
+		Secrets:   len(hook.Signing.Secrets),
+		Fields:    nonNil(hook.Fields),
+		Rules:     nonNil(hook.Rules),
+		Transform: hook.Transform.Body != "" || hook.Transform.BodyFile != "" || len(hook.Transform.Headers) > 0,
+		Circuits:  c.Circuits(),
+	}
+	for _, dest := range hook.Destinations {
+		auth := hook.Auth.Type
+		if dest.Auth != nil {
+			auth = dest.Auth.Type
+		}
+		view.Destinations = append(view.Destinations, destinationView{
+			Name:      dest.Name,
+			URL:       redactURL(dest.URL),
+			Transform: dest.Transform != nil,
+			Auth:      auth,
+		})
+	}
+	return view
+}
+
+// nonNil makes empty lists show up as [] rather than null.
+func nonNil[T any](list []T) []T {
+	if list == nil {
+		return []T{}
+	}
+	return list
+}
+
+// redactURL reduces a destination URL to its scheme and host. The rest is
+// often a credential itself, eg: the token in the path of a Discord webhook.
+func redactURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return "[REDACTED]"
+	}
+	return u.Scheme + "://" + u.Host
+}
+
+// health reports 503 as long as the broker or the store is unavailable, so it
+// can be used as a readiness probe. Circuits that are not closed are listed, as
+// webhook/destination, but do not make the service unhealthy: they are a
+// problem of the receiver.
+func (s *Server) health(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), healthTimeout)
+	defer cancel()
+
+	broker := s.broker != nil && s.broker.Connected()
+	store := s.store != nil && s.store.Ping(ctx) == nil
+
+	openCircuits := []string{}
+	for _, c := range s.consumers {
+		for _, circuit := range c.Circuits() {
+			if circuit.State != consumer.CircuitClosed {
+				openCircuits = append(openCircuits, c.Name()+"/"+circuit.Destination)
+			}
+		}
+	}
+
+	status, code := "ok", http.StatusOK
+	if !broker || !store {
+		status, code = "degraded", http.StatusServiceUnavailable
+	}
+	writeJSON(w, code, map[string]any{
+		"status":    status,
+		"broker":    broker,
+		"store":     store,
+		"consumers": len(s.consumers),
+		"circuits":  openCircuits,
+		"uptime":    time.Since(s.started).Round(time.Second).String(),
+	})
+}
+
+func (s *Server) listWebhooks(w http.ResponseWriter, r *http.Request) {
+	views := make([]webhookView, 0, len(s.consumers))
+	for _, c := range s.consumers {
+		views = append(views, newWebhookView(c))
+	}
+	writeJSON(w, http.StatusOK, views)
+}
+
+func (s *Server) getWebhook(w http.ResponseWriter, r *http.Request) {
+	c, ok := s.consumer(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, newWebhookView(c))
+}
+
+// webhookLogs lists logged attempts, newest first. Query parameters:
+// destination, message_id, q (part of the payload description, eg: a team
+// name), limit and before (an attempt id, for paging).
+func (s *Server) webhookLogs(w http.ResponseWriter, r *http.Request) {
+	c, ok := s.consumer(w, r)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	filter := pkg.AttemptFilter{
+		Webhook:     c.Name(),
+		Destination: query.Get("destination"),
+		MessageID:   query.Get("message_id"),
+		Description: query.Get("q"),
+		Limit:       defaultLogLimit,
+	}
+	if limit := query.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid limit %q", limit))
+			return
+		}
+		filter.Limit = min(n, maxLogLimit)
+	}
+	if before := query.Get("before"); before != "" {
+		id, err := strconv.ParseInt(before, 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid before %q", before))
+			return
+		}
+		filter.Before = id
+	}
+
+	attempts, err := s.store.Attempts(r.Context(), filter)
+	if err != nil {
+		pkg.Log.Error("Failed to query delivery log", err)
+		writeError(w, http.StatusInternalServerError, errors.New("failed to query delivery log"))
+		return
+	}
+	writeJSON(w, http.StatusOK, attempts)
+}
+
+// webhookStats summarises the delivery log per destination over the duration
+// in the `since` query parameter (default 24h).
+func (s *Server) webhookStats(w http.ResponseWriter, r *http.Request) {
+	c, ok := s.consumer(w, r)
+	if !ok {
+		return
+	}
+
+	window := 24 * time.Hour
+	if since := r.URL.Query().Get("since"); since != "" {
+		d, err := time.ParseDuration(since)
+		if err != nil || d <= 0 {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid since %q", since))
+			return
+		}
+		window = d
+	}
+
+	stats, err := s.store.Stats(r.Context(), c.Name(), time.Now().Add(-window))
+	if err != nil {
+		pkg.Log.Error("Failed to query delivery statistics", err)
+		writeError(w, http.StatusInternalServerError, errors.New("failed to query delivery statistics"))
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"webhook":      c.Name(),
+		"since":        window.String(),
+		"destinations": stats,
+	})
+}
+
+// testWebhook delivers the request body as a message of the webhook, to all
+// destinations it is routed to or only to the `destination` query parameter.
+func (s *Server) testWebhook(w http.ResponseWriter, r *http.Request) {
+	c, ok := s.consumer(w, r)
+	if !ok {
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize))
+	if err != nil {
+		writeError(w, http.StatusRequestEntityTooLarge, err)
+		return
+	}
+
+	results, err := c.TestDelivery(r.Context(), body, r.URL.Query().Get("destination"))
+	if errors.Is(err, consumer.ErrUnknownDestination) {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		// The message would have been dead-lettered
+		writeError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, results)
+}
+
+// replayRequest is the body of POST /webhooks/{name}/deadletters/replay.
+type replayRequest struct {
+	consumer.DeadLetterFilter
+	consumer.ReplayEdit
+}
+
+// listDeadLetters lists the messages in the dead-letter queue of a webhook.
+// Query parameters: since (a duration) or from and until (RFC 3339), reason,
+// destination, message_id, where (field=value) and limit.
+func (s *Server) listDeadLetters(w http.ResponseWriter, r *http.Request) {
+	c, ok := s.consumer(w, r)
+	if !ok {
+		return
+	}
+	if !s.brokerAvailable(w) {
+		return
+	}
+
+	filter, err := deadLetterFilter(r.URL.Query())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	messages, err := c.DeadLetters(r.Context(), filter)
+	if err != nil {
+		pkg.Log.Error("Failed to read dead letters", err)
+		writeError(w, http.StatusBadGateway, errors.New("failed to read dead letters"))
+		return
+	}
+	writeJSON(w, http.StatusOK, messages)
+}
+
+// replayDeadLetters moves the matching dead letters back into the queue of the
+// webhook. The body holds the filter fields of listDeadLetters, as JSON, and
+// optionally `set` (field paths to values) or `body` (a replacement message).
+func (s *Server) replayDeadLetters(w http.ResponseWriter, r *http.Request) {
+	c, ok := s.consumer(w, r)
+	if !ok {
+		return
+	}
+	if !s.brokerAvailable(w) {
+		return
+	}
+
+	var req replayRequest
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodySize))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+		return
+	}
+
+	replayed, err := c.Replay(r.Context(), req.DeadLetterFilter, req.ReplayEdit)
+	if err != nil {
+		// Messages replayed before the error stay replayed
+		writeJSON(w, http.StatusUnprocessableEntity, map[string]any{
+			"error":    err.Error(),
+			"replayed": nonNil(replayed),
+		})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"replayed": replayed})
+}
+
+func (s *Server) brokerAvailable(w http.ResponseWriter) bool {
+	if s.broker == nil || !s.broker.Connected() {
+		writeError(w, http.StatusServiceUnavailable, errors.New("not connected to RabbitMQ"))
+		return false
+	}
+	return true
+}
+
+func deadLetterFilter(query url.Values) (consumer.DeadLetterFilter, error) {
+	filter := consumer.DeadLetterFilter{
+		Reason:      query.Get("reason"),
+		Destination: query.Get("destination"),
+		MessageID:   query.Get("message_id"),
+	}
+	if since := query.Get("since"); since != "" {
+		d, err := time.ParseDuration(since)
+		if err != nil || d <= 0 {
+			return filter, fmt.Errorf("invalid since %q", since)
+		}
+		filter.From = time.Now().Add(-d)
+	}
+	for param, target := range map[string]*time.Time{"from": &filter.From, "until": &filter.Until} {
+		if value := query.Get(param); value != "" {
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return filter, fmt.Errorf("invalid %s %q", param, value)
+			}
+			*target = t
+		}
+	}
+	if where := query.Get("where"); where != "" {
+		field, value, ok := strings.Cut(where, "=")
+		if !ok {
+			return filter, fmt.Errorf("invalid where %q, expected field=value", where)
+		}
+		filter.Field, filter.Value = field, value
+	}
+	if limit := query.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 {
+			return filter, fmt.Errorf("invalid limit %q", limit)
+		}
+		filter.Limit = n
+	}
+	return filter, nil
+}
@@ -0,0 +1,129 @@
+// Package api is the admin HTTP API of the service. It exposes the webhook
+// configuration, the delivery log and its statistics, lets operators send
+// test messages without going through RabbitMQ and replay dead letters.
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/IAmRiteshKoushik/termite/consumer"
+	"github.com/IAmRiteshKoushik/termite/pkg"
+)
+
+// Time in-flight requests get to finish once the service shuts down
+const shutdownTimeout = 5 * time.Second
+
+// Largest request body accepted, eg: a test message
+const maxBodySize = 1 << 20
+
+type Server struct {
+	config    pkg.APIConfig
+	consumers []*consumer.WebhookConsumer
+	broker    *pkg.MsgBroker
+	store     *pkg.Store
+	started   time.Time
+}
+
+func NewServer(config pkg.APIConfig, consumers []*consumer.WebhookConsumer, broker *pkg.MsgBroker, store *pkg.Store) *Server {
+	return &Server{
+		config:    config,
+		consumers: consumers,
+		broker:    broker,
+		store:     store,
+		started:   time.Now(),
+	}
+}
+
+// Handler returns the routes of the API, all of them below /api/v1.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v1/health", s.health)
+	mux.Handle("GET /api/v1/webhooks", s.authorized(s.listWebhooks))
+	mux.Handle("GET /api/v1/webhooks/{name}", s.authorized(s.getWebhook))
+	mux.Handle("GET /api/v1/webhooks/{name}/logs", s.authorized(s.webhookLogs))
+	mux.Handle("GET /api/v1/webhooks/{name}/stats", s.authorized(s.webhookStats))
+	mux.Handle("POST /api/v1/webhooks/{name}/test", s.authorized(s.testWebhook))
+	mux.Handle("GET /api/v1/webhooks/{name}/deadletters", s.authorized(s.listDeadLetters))
+	mux.Handle("POST /api/v1/webhooks/{name}/deadletters/replay", s.authorized(s.replayDeadLetters))
+	return mux
+}
+
+// Run serves the API until ctx is cancelled and then waits for in-flight
+// requests to finish.
+func (s *Server) Run(ctx context.Context) error {
+	server := &http.Server{
+		Addr:              s.config.Listen,
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	errChan := make(chan error, 1)
+	go func() {
+		pkg.Log.Info(fmt.Sprintf("Admin API listening on %s", s.config.Listen))
+		errChan <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errChan:
+		return fmt.Errorf("admin API stopped: %w", err)
+	case <-ctx.Done():
+	}
+
+	pkg.Log.Info("Shutting down admin API...")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("failed to shut down admin API: %w", err)
+	}
+	if err := <-errChan; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// authorized rejects requests without the configured bearer token.
+func (s *Server) authorized(next http.HandlerFunc) http.Handler {
+	if s.config.Token == "" {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.config.Token)) != 1 {
+			writeError(w, http.StatusUnauthorized, errors.New("missing or invalid bearer token"))
+			return
+		}
+		next(w, r)
+	})
+}
+
+// consumer looks up the webhook named in the path and answers 404 for unknown
+// names.
+func (s *Server) consumer(w http.ResponseWriter, r *http.Request) (*consumer.WebhookConsumer, bool) {
+	name := r.PathValue("name")
+	for _, c := range s.consumers {
+		if c.Name() == name {
+			return c, true
+		}
+	}
+	writeError(w, http.StatusNotFound, fmt.Errorf("unknown webhook %q", name))
+	return nil, false
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		pkg.Log.Error("Failed to write API response", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,105 @@
+package consumer
+
+import (
+	"encoding/json"
+	"slices"
+	"strings"
+)
+
+type HackathonPayload struct {
+	TeamName          string                `json:"team_name" validate:"required,max=100"`
+	LeaderName        string                `json:"leader_name" validate:"required"`
+	LeaderEmail       string                `json:"leader_email" validate:"required,email"`
+	LeaderPhoneNumber string                `json:"leader_phone_number" validate:"required,phone"`
+	LeaderCollegeName string                `json:"leader_college_name" validate:"required"`
+	ProblemStatements ProblemStatements     `json:"problem_statements" validate:"required"`
+	TeamMembers       []HackathonTeamMember `json:"team_members" validate:"required,min=1"`
+}
+
+type HackathonTeamMember struct {
+	Name        string `json:"name" validate:"required"`
+	Email       string `json:"email" validate:"required,email"`
+	PhoneNumber string `json:"phone_number" validate:"required,phone"`
+	CollegeName string `json:"college_name" validate:"required"`
+}
+
+// ProblemStatements holds the tracks a team registered for. Producers send
+// either a single track ("aiot") or a list (["agentic_ai", "generative_ai"]);
+// both decode into a list, which is also what the receiver gets.
+type ProblemStatements []string
+
+func init() {
+	registerSchema("hackathon", func() Payload { return &HackathonPayload{} })
+	registerUpgrade("hackathon", 1, upgradeHackathonV1)
+}
+
+// Version 1 had a single `problem_statement` string, version 2 lists the
+// tracks under `problem_statements`.
+func upgradeHackathonV1(doc map[string]any) error {
+	if statement, ok := doc["problem_statement"]; ok {
+		if _, exists := doc["problem_statements"]; !exists {
+			doc["problem_statements"] = statement
+		}
+		delete(doc, "problem_statement")
+	}
+	return nil
+}
+
+func (p *HackathonPayload) Describe() string {
+	return "team: " + p.TeamName
+}
+
+// UnmarshalJSON accepts the tracks under both `problem_statements` and the
+// older `problem_statement` key and merges them into ProblemStatements. This
+// keeps v2 messages from producers that still use the old key working.
+func (p *HackathonPayload) UnmarshalJSON(data []byte) error {
+	// plain has the same fields but not this method, avoiding recursion
+	type plain HackathonPayload
+	var decoded struct {
+		plain
+		ProblemStatement ProblemStatements `json:"problem_statement"`
+	}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+
+	*p = HackathonPayload(decoded.plain)
+	p.ProblemStatements = normalizeTracks(append(p.ProblemStatements, decoded.ProblemStatement...))
+	return nil
+}
+
+func (s *ProblemStatements) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*s = ProblemStatements{single}
+		return nil
+	}
+
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*s = list
+	return nil
+}
+
+// MarshalJSON always encodes a list, never null.
+func (s ProblemStatements) MarshalJSON() ([]byte, error) {
+	if s == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal([]string(s))
+}
+
+// normalizeTracks lowercases and trims every track and drops blanks and
+// duplicates, keeping the order the team picked them in.
+func normalizeTracks(tracks ProblemStatements) ProblemStatements {
+	normalized := ProblemStatements{}
+	for _, track := range tracks {
+		track = strings.ToLower(strings.TrimSpace(track))
+		if track != "" && !slices.Contains(normalized, track) {
+			normalized = append(normalized, track)
+		}
+	}
+	return normalized
+}
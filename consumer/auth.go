@@ -0,0 +1,149 @@
+package consumer
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/IAmRiteshKoushik/termite/pkg"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+// authenticator adds the credentials of a destination to its requests, in the
+// header returned by credentialHeader.
+type authenticator interface {
+	authenticate(req *http.Request) error
+	credentialHeader() string
+}
+
+type bearerAuth struct {
+	token string
+}
+
+func (a *bearerAuth) authenticate(req *http.Request) error {
+	req.Header.Set("Authorization", "Bearer "+a.token)
+	return nil
+}
+
+func (a *bearerAuth) credentialHeader() string {
+	return "Authorization"
+}
+
+type basicAuth struct {
+	username string
+	password string
+}
+
+func (a *basicAuth) authenticate(req *http.Request) error {
+	req.SetBasicAuth(a.username, a.password)
+	return nil
+}
+
+func (a *basicAuth) credentialHeader() string {
+	return "Authorization"
+}
+
+type apiKeyAuth struct {
+	header string
+	key    string
+}
+
+func (a *apiKeyAuth) authenticate(req *http.Request) error {
+	req.Header.Set(a.header, a.key)
+	return nil
+}
+
+func (a *apiKeyAuth) credentialHeader() string {
+	return a.header
+}
+
+// How long before its expiry a cached OAuth2 token is no longer used, so that
+// it does not run out while the request is on its way
+const tokenExpiryMargin = 10 * time.Second
+
+// oauth2Auth sends a token obtained with the client credentials grant. The
+// token is cached and only fetched again shortly before it expires, or after
+// the receiver rejected it. Fetches use the context of the request, so a slow
+// token endpoint is given up on at shutdown like the request itself.
+type oauth2Auth struct {
+	config clientcredentials.Config
+	client *http.Client
+	now    func() time.Time
+
+	mu    sync.Mutex
+	token *oauth2.Token
+}
+
+func newOAuth2Auth(config clientcredentials.Config, client *http.Client) *oauth2Auth {
+	return &oauth2Auth{config: config, client: client, now: time.Now}
+}
+
+func (a *oauth2Auth) authenticate(req *http.Request) error {
+	token, err := a.currentToken(req.Context())
+	if err != nil {
+		return fmt.Errorf("failed to get OAuth2 token: %w", err)
+	}
+	token.SetAuthHeader(req)
+	return nil
+}
+
+func (a *oauth2Auth) credentialHeader() string {
+	return "Authorization"
+}
+
+// currentToken returns the cached token, fetching a new one when there is
+// none or it is about to expire. Concurrent requests wait for a single fetch.
+func (a *oauth2Auth) currentToken(ctx context.Context) (*oauth2.Token, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.token != nil && (a.token.Expiry.IsZero() || a.now().Before(a.token.Expiry.Add(-tokenExpiryMargin))) {
+		return a.token, nil
+	}
+	token, err := a.config.Token(context.WithValue(ctx, oauth2.HTTPClient, a.client))
+	if err != nil {
+		return nil, err
+	}
+	a.token = token
+	return token, nil
+}
+
+// invalidate drops the cached token, eg: after a 401 because it was revoked,
+// so that the next request fetches a new one.
+func (a *oauth2Auth) invalidate() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.token = nil
+}
+
+// newAuthenticator returns the authenticator for config, nil when requests go
+// out without credentials. OAuth2 tokens are fetched with client, so the
+// token endpoint gets the same timeouts as the destination.
+func newAuthenticator(config pkg.AuthConfig, client *http.Client) authenticator {
+	switch config.Type {
+	case pkg.AuthBearer:
+		return &bearerAuth{token: config.Token}
+	case pkg.AuthBasic:
+		return &basicAuth{username: config.Username, password: config.Password}
+	case pkg.AuthAPIKey:
+		return &apiKeyAuth{header: config.Header, key: config.Key}
+	case pkg.AuthOAuth2:
+		params := url.Values{}
+		for name, value := range config.EndpointParams {
+			params.Set(name, value)
+		}
+		credentials := clientcredentials.Config{
+			ClientID:       config.ClientID,
+			ClientSecret:   config.ClientSecret,
+			TokenURL:       config.TokenURL,
+			Scopes:         config.Scopes,
+			EndpointParams: params,
+		}
+		return newOAuth2Auth(credentials, client)
+	}
+	return nil
+}
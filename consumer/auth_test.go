@@ -0,0 +1,188 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/IAmRiteshKoushik/termite/pkg"
+	"github.com/rs/zerolog"
+)
+
+// oauth2Server is a token endpoint handing out token-1, token-2, ... and a
+// receiver that records the Authorization header of every request and
+// answers 401 for revoked tokens. While down, the token endpoint answers 503.
+type oauth2Server struct {
+	tokenServer *httptest.Server
+	receiver    *httptest.Server
+	expiresIn   int
+
+	mu      sync.Mutex
+	down    bool
+	issued  int
+	seen    []string
+	revoked map[string]bool
+}
+
+func newOAuth2Server(t *testing.T, expiresIn int) *oauth2Server {
+	s := &oauth2Server{expiresIn: expiresIn, revoked: map[string]bool{}}
+	s.tokenServer = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("grant_type") != "client_credentials" {
+			http.Error(w, "unsupported grant type", http.StatusBadRequest)
+			return
+		}
+		s.mu.Lock()
+		if s.down {
+			s.mu.Unlock()
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		s.issued++
+		token := fmt.Sprintf("token-%d", s.issued)
+		s.mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"access_token":%q,"token_type":"Bearer","expires_in":%d}`, token, s.expiresIn)
+	}))
+	s.receiver = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := r.Header.Get("Authorization")
+		s.mu.Lock()
+		s.seen = append(s.seen, header)
+		revoked := s.revoked[header]
+		s.mu.Unlock()
+		if revoked {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	t.Cleanup(s.tokenServer.Close)
+	t.Cleanup(s.receiver.Close)
+	return s
+}
+
+func (s *oauth2Server) revoke(token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.revoked["Bearer "+token] = true
+}
+
+func (s *oauth2Server) tokensIssued() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.issued
+}
+
+func (s *oauth2Server) lastAuthorization() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.seen) == 0 {
+		return ""
+	}
+	return s.seen[len(s.seen)-1]
+}
+
+// newOAuth2Consumer returns a consumer with one destination, the receiver of
+// s, authenticated against the token endpoint of s.
+func newOAuth2Consumer(s *oauth2Server, statusCodes pkg.StatusCodes) (*WebhookConsumer, *destination) {
+	pkg.Log = &pkg.LoggerService{Logger: zerolog.Nop()}
+
+	hook := pkg.WebhookConfig{Name: "test", StatusCodes: statusCodes}
+	client := newHTTPClient(hook.Timeouts)
+	dest := &destination{
+		name: "receiver",
+		url:  s.receiver.URL,
+		auth: newAuthenticator(pkg.AuthConfig{
+			Type:         pkg.AuthOAuth2,
+			TokenURL:     s.tokenServer.URL,
+			ClientID:     "termite",
+			ClientSecret: "change-me",
+		}, client),
+	}
+	return &WebhookConsumer{hook: hook, client: client}, dest
+}
+
+func testOutgoing() *outgoing {
+	return &outgoing{
+		body:           []byte(`{"team_name":"Rocket"}`),
+		contentType:    "application/json",
+		description:    "team Rocket",
+		idempotencyKey: "8f14e45f",
+		attempt:        1,
+	}
+}
+
+func TestOAuth2TokenIsCachedUntilItExpires(t *testing.T) {
+	s := newOAuth2Server(t, 3600)
+	c, dest := newOAuth2Consumer(s, nil)
+	now := time.Now()
+	dest.auth.(*oauth2Auth).now = func() time.Time { return now }
+
+	for range 2 {
+		if err := c.dispatch(context.Background(), dest, testOutgoing()); err != nil {
+			t.Fatalf("dispatch failed: %v", err)
+		}
+		if got := s.lastAuthorization(); got != "Bearer token-1" {
+			t.Fatalf("Authorization = %q, want %q", got, "Bearer token-1")
+		}
+	}
+	if got := s.tokensIssued(); got != 1 {
+		t.Fatalf("%d tokens fetched, want the first one to be cached", got)
+	}
+
+	// Tokens are given up on tokenExpiryMargin before they expire
+	now = now.Add(time.Hour - tokenExpiryMargin + time.Second)
+	if err := c.dispatch(context.Background(), dest, testOutgoing()); err != nil {
+		t.Fatalf("dispatch failed: %v", err)
+	}
+	if got := s.lastAuthorization(); got != "Bearer token-2" {
+		t.Fatalf("Authorization after expiry = %q, want %q", got, "Bearer token-2")
+	}
+	if got := s.tokensIssued(); got != 2 {
+		t.Fatalf("%d tokens fetched, want 2", got)
+	}
+}
+
+func TestOAuth2TokenIsDroppedOnUnauthorized(t *testing.T) {
+	s := newOAuth2Server(t, 3600)
+	// Even when 401s are mapped to dead_letter, a rejected token is retried
+	c, dest := newOAuth2Consumer(s, pkg.StatusCodes{"401": pkg.StatusActionDeadLetter})
+
+	if err := c.dispatch(context.Background(), dest, testOutgoing()); err != nil {
+		t.Fatalf("dispatch failed: %v", err)
+	}
+	s.revoke("token-1")
+
+	err := c.dispatch(context.Background(), dest, testOutgoing())
+	var retryable *retryableStatusError
+	if !errors.As(err, &retryable) || retryable.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("dispatch with a revoked token = %v, want a retryable 401", err)
+	}
+
+	if err := c.dispatch(context.Background(), dest, testOutgoing()); err != nil {
+		t.Fatalf("dispatch after the 401 failed: %v", err)
+	}
+	if got := s.lastAuthorization(); got != "Bearer token-2" {
+		t.Fatalf("Authorization after the 401 = %q, want %q", got, "Bearer token-2")
+	}
+	if got := s.tokensIssued(); got != 2 {
+		t.Fatalf("%d tokens fetched, want 2", got)
+	}
+}
+
+func TestOAuth2TokenFailureIsANetworkError(t *testing.T) {
+	s := newOAuth2Server(t, 3600)
+	s.down = true
+	c, dest := newOAuth2Consumer(s, nil)
+
+	err := c.dispatch(context.Background(), dest, testOutgoing())
+	var network *networkError
+	if !errors.As(err, &network) {
+		t.Fatalf("dispatch without a token = %v, want a network error", err)
+	}
+	if got := s.lastAuthorization(); got != "" {
+		t.Fatalf("receiver got a request with Authorization %q, want none", got)
+	}
+}
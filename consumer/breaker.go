@@ -0,0 +1,275 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/IAmRiteshKoushik/termite/pkg"
+)
+
+// States of a circuit breaker
+const (
+	CircuitClosed   = "closed"
+	CircuitOpen     = "open"
+	CircuitHalfOpen = "half-open"
+)
+
+// breaker is the circuit breaker of one destination. Closed, every dispatch
+// goes through. Open, dispatches wait until the cool-down is over. Half-open,
+// one dispatch at a time probes the destination while the rest keep waiting
+// for its outcome.
+type breaker struct {
+	name   string
+	config pkg.BreakerConfig
+
+	mu        sync.Mutex
+	state     string
+	failures  int
+	successes int
+	openedAt  time.Time
+	probing   bool
+	// Closed and replaced on every state change, to wake up waiters
+	changed chan struct{}
+}
+
+// CircuitStatus is the state of the circuit breaker of one destination.
+// RetryAt is when an open circuit lets the next probe through.
+type CircuitStatus struct {
+	Destination string    `json:"destination"`
+	State       string    `json:"state"`
+	Failures    int       `json:"consecutive_failures"`
+	OpenedAt    time.Time `json:"opened_at,omitzero"`
+	RetryAt     time.Time `json:"retry_at,omitzero"`
+}
+
+func newBreaker(name string, config pkg.BreakerConfig) *breaker {
+	return &breaker{
+		name:    name,
+		config:  config,
+		state:   CircuitClosed,
+		changed: make(chan struct{}),
+	}
+}
+
+// countsAsFailure reports whether err says something about the health of the
+// receiver: no response at all, a 5xx, 408 or 429. Other statuses mean the
+// receiver is up and rejected this one message.
+func countsAsFailure(err error) bool {
+	var se *statusError
+	if !errors.As(err, &se) {
+		return true
+	}
+	return se.StatusCode >= 500 ||
+		se.StatusCode == http.StatusRequestTimeout ||
+		se.StatusCode == http.StatusTooManyRequests
+}
+
+// acquire waits until b lets a dispatch through. Every successful acquire must
+// be followed by a call to record. It fails with errNotAttempted once ctx is
+// cancelled.
+func (b *breaker) acquire(ctx context.Context) error {
+	for {
+		b.mu.Lock()
+		b.refreshLocked()
+		switch {
+		case b.state == CircuitClosed:
+			b.mu.Unlock()
+			return nil
+		case b.state == CircuitHalfOpen && !b.probing:
+			b.probing = true
+			b.mu.Unlock()
+			return nil
+		}
+		changed := b.changed
+		var wait time.Duration
+		if b.state == CircuitOpen {
+			wait = max(time.Until(b.retryAtLocked()), time.Millisecond)
+		}
+		b.mu.Unlock()
+
+		if err := waitFor(ctx, changed, wait); err != nil {
+			return fmt.Errorf("%w: circuit of %s is open", errNotAttempted, b.name)
+		}
+	}
+}
+
+// record feeds the outcome of a dispatch let through by acquire into b. A
+// dispatch that was given up on before it was sent only frees its probe.
+func (b *breaker) record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if errors.Is(err, errNotAttempted) {
+		if b.state == CircuitHalfOpen && b.probing {
+			b.probing = false
+			b.notifyLocked()
+		}
+		return
+	}
+
+	failed := err != nil && countsAsFailure(err)
+	switch b.state {
+	case CircuitClosed:
+		if !failed {
+			b.failures = 0
+			return
+		}
+		b.failures++
+		if b.failures >= b.config.FailureThreshold {
+			pkg.Log.Warn(fmt.Sprintf("Circuit of %s opened after %d consecutive failures, next probe in %s",
+				b.name, b.failures, b.config.CoolDown))
+			b.openLocked()
+		}
+	case CircuitHalfOpen:
+		b.probing = false
+		if failed {
+			b.failures++
+			pkg.Log.Warn(fmt.Sprintf("Probe of %s failed, circuit re-opened, next probe in %s: %v",
+				b.name, b.config.CoolDown, err))
+			b.openLocked()
+			return
+		}
+		b.successes++
+		if b.successes >= b.config.SuccessThreshold {
+			pkg.Log.Info(fmt.Sprintf("Circuit of %s closed, destination recovered", b.name))
+			b.setLocked(CircuitClosed)
+			return
+		}
+		b.notifyLocked() // Let the next probe through
+	case CircuitOpen:
+		// Dispatched before the circuit opened, says nothing new
+	}
+}
+
+// status returns the current state of b for destination.
+func (b *breaker) status(destination string) CircuitStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refreshLocked()
+
+	status := CircuitStatus{Destination: destination, State: b.state, Failures: b.failures}
+	if b.state != CircuitClosed {
+		status.OpenedAt = b.openedAt
+	}
+	if b.state == CircuitOpen {
+		status.RetryAt = b.retryAtLocked()
+	}
+	return status
+}
+
+// refreshLocked moves an open circuit whose cool-down is over to half-open.
+func (b *breaker) refreshLocked() {
+	if b.state == CircuitOpen && !time.Now().Before(b.retryAtLocked()) {
+		pkg.Log.Info(fmt.Sprintf("Circuit of %s half-open, probing the destination", b.name))
+		b.setLocked(CircuitHalfOpen)
+	}
+}
+
+func (b *breaker) retryAtLocked() time.Time {
+	return b.openedAt.Add(b.config.CoolDown)
+}
+
+func (b *breaker) openLocked() {
+	b.openedAt = time.Now()
+	b.setLocked(CircuitOpen)
+}
+
+func (b *breaker) setLocked(state string) {
+	b.state = state
+	b.successes = 0
+	b.probing = false
+	if state == CircuitClosed {
+		b.failures = 0
+	}
+	b.notifyLocked()
+}
+
+func (b *breaker) notifyLocked() {
+	close(b.changed)
+	b.changed = make(chan struct{})
+}
+
+// waitFor blocks until changed is closed, wait is over (a non-positive wait
+// means no timeout) or ctx is cancelled, which is the only error.
+func waitFor(ctx context.Context, changed <-chan struct{}, wait time.Duration) error {
+	var timeout <-chan time.Time
+	if wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case <-changed:
+	case <-timeout:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return nil
+}
+
+// Circuits returns the state of the circuit breaker of every destination,
+// none when circuit breaking is disabled.
+func (c *WebhookConsumer) Circuits() []CircuitStatus {
+	circuits := []CircuitStatus{}
+	for _, dest := range c.destinations {
+		if dest.breaker != nil {
+			circuits = append(circuits, dest.breaker.status(dest.name))
+		}
+	}
+	return circuits
+}
+
+// waitForCircuits blocks while the circuit of any destination is open or
+// half-open with a probe in flight, so that no new messages are taken from the
+// queue while they could not be delivered anyway. It returns false once ctx is
+// cancelled.
+func (c *WebhookConsumer) waitForCircuits(ctx context.Context) bool {
+	paused := false
+	for {
+		var blocked *destination
+		var why string
+		var wait time.Duration // Until the next probe, 0 while one is in flight
+		var changed chan struct{}
+		for _, dest := range c.destinations {
+			if dest.breaker == nil {
+				continue
+			}
+			b := dest.breaker
+			b.mu.Lock()
+			b.refreshLocked()
+			switch {
+			case b.state == CircuitOpen:
+				retryAt := b.retryAtLocked()
+				blocked, changed = dest, b.changed
+				why = "is open until " + retryAt.Format(time.RFC3339)
+				wait = max(time.Until(retryAt), time.Millisecond)
+			case b.state == CircuitHalfOpen && b.probing:
+				blocked, changed = dest, b.changed
+				why, wait = "is being probed", 0
+			}
+			b.mu.Unlock()
+			if blocked != nil {
+				break
+			}
+		}
+
+		if blocked == nil {
+			if paused {
+				pkg.Log.Info(fmt.Sprintf("Resuming %s consumer", c.hook.Name))
+			}
+			return true
+		}
+		if !paused {
+			pkg.Log.Warn(fmt.Sprintf("Pausing %s consumer, circuit of destination %s %s",
+				c.hook.Name, blocked.name, why))
+			paused = true
+		}
+		if waitFor(ctx, changed, wait) != nil {
+			return false
+		}
+	}
+}
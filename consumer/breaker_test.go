@@ -0,0 +1,160 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/IAmRiteshKoushik/termite/pkg"
+	"github.com/rs/zerolog"
+)
+
+func TestCountsAsFailure(t *testing.T) {
+	status := func(code int) error {
+		return &retryableStatusError{&statusError{StatusCode: code, Status: fmt.Sprint(code)}}
+	}
+
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"no response", &networkError{err: errors.New("connection refused")}, true},
+		{"500", status(500), true},
+		{"503", status(503), true},
+		{"408", status(408), true},
+		{"429", status(429), true},
+		{"400", &permanentStatusError{&statusError{StatusCode: 400}}, false},
+		{"409", status(409), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := countsAsFailure(tt.err); got != tt.want {
+				t.Fatalf("countsAsFailure(%v) = %t, want %t", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBreakerStates(t *testing.T) {
+	pkg.Log = &pkg.LoggerService{Logger: zerolog.Nop()}
+
+	failed := &networkError{err: errors.New("connection refused")}
+	rejected := &permanentStatusError{&statusError{StatusCode: 400}}
+
+	// Each step acquires the breaker (unless it is open), records the
+	// outcome and checks the resulting state. "cool down" ends the
+	// cool-down of an open circuit instead.
+	type step struct {
+		name    string
+		outcome error
+		want    string
+	}
+	const coolDown = "cool down"
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{"failures below the threshold", []step{
+			{"fail", failed, CircuitClosed},
+			{"succeed", nil, CircuitClosed},
+			{"fail", failed, CircuitClosed},
+		}},
+		{"rejections do not count", []step{
+			{"fail", failed, CircuitClosed},
+			{"reject", rejected, CircuitClosed},
+			{"reject", rejected, CircuitClosed},
+		}},
+		{"opens and recovers", []step{
+			{"fail", failed, CircuitClosed},
+			{"fail", failed, CircuitOpen},
+			{coolDown, nil, CircuitHalfOpen},
+			{"probe succeeds", nil, CircuitHalfOpen},
+			{"probe succeeds", nil, CircuitClosed},
+		}},
+		{"failed probe re-opens", []step{
+			{"fail", failed, CircuitClosed},
+			{"fail", failed, CircuitOpen},
+			{coolDown, nil, CircuitHalfOpen},
+			{"probe succeeds", nil, CircuitHalfOpen},
+			{"probe fails", failed, CircuitOpen},
+		}},
+		{"aborted probe frees the probe", []step{
+			{"fail", failed, CircuitClosed},
+			{"fail", failed, CircuitOpen},
+			{coolDown, nil, CircuitHalfOpen},
+			{"probe aborted", errNotAttempted, CircuitHalfOpen},
+			{"probe succeeds", nil, CircuitHalfOpen},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newBreaker("test", pkg.BreakerConfig{FailureThreshold: 2, CoolDown: time.Minute, SuccessThreshold: 2})
+			for i, s := range tt.steps {
+				if s.name == coolDown {
+					b.mu.Lock()
+					b.openedAt = time.Now().Add(-time.Minute)
+					b.mu.Unlock()
+				} else {
+					ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+					err := b.acquire(ctx)
+					cancel()
+					if err != nil {
+						t.Fatalf("step %d (%s): acquire failed: %v", i+1, s.name, err)
+					}
+					b.record(s.outcome)
+				}
+				if got := b.status("test").State; got != s.want {
+					t.Fatalf("step %d (%s): state %s, want %s", i+1, s.name, got, s.want)
+				}
+			}
+		})
+	}
+}
+
+func TestBreakerOpenBlocksAcquire(t *testing.T) {
+	pkg.Log = &pkg.LoggerService{Logger: zerolog.Nop()}
+
+	b := newBreaker("test", pkg.BreakerConfig{FailureThreshold: 1, CoolDown: time.Minute, SuccessThreshold: 1})
+	b.record(&networkError{err: errors.New("connection refused")})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := b.acquire(ctx); !errors.Is(err, errNotAttempted) {
+		t.Fatalf("acquire on an open circuit = %v, want errNotAttempted", err)
+	}
+}
+
+func TestWaitForCircuitsWhileProbing(t *testing.T) {
+	pkg.Log = &pkg.LoggerService{Logger: zerolog.Nop()}
+
+	b := newBreaker("test", pkg.BreakerConfig{FailureThreshold: 1, CoolDown: time.Minute, SuccessThreshold: 1})
+	c := &WebhookConsumer{destinations: []*destination{{name: "portal", breaker: b}}}
+	b.record(&networkError{err: errors.New("connection refused")})
+	b.mu.Lock()
+	b.openedAt = time.Now().Add(-time.Minute)
+	b.mu.Unlock()
+	if err := b.acquire(context.Background()); err != nil {
+		t.Fatalf("acquire of the probe failed: %v", err)
+	}
+
+	resumed := make(chan bool)
+	go func() { resumed <- c.waitForCircuits(context.Background()) }()
+	select {
+	case <-resumed:
+		t.Fatal("consumer resumed while the probe was in flight")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	b.record(nil)
+	select {
+	case ok := <-resumed:
+		if !ok {
+			t.Fatal("waitForCircuits = false, want true")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("consumer did not resume after the probe succeeded")
+	}
+}
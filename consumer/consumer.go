@@ -0,0 +1,460 @@
+package consumer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/IAmRiteshKoushik/termite/pkg"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// WebhookConsumer drains the queue of a single `[[webhooks]]` entry and
+// forwards every message to each of that entry's destinations.
+type WebhookConsumer struct {
+	hook         pkg.WebhookConfig
+	schema       Schema
+	rules        []validationRule
+	fields       *fieldPolicy
+	destinations []*destination
+	routes       []route
+	broker       *pkg.MsgBroker
+	store        *pkg.Store
+	client       *http.Client
+}
+
+// message is a delivery that passed decoding and validation, rendered once for
+// all of the destinations it goes to.
+type message struct {
+	body         []byte
+	description  string
+	key          string
+	attempt      int
+	destinations []*destination
+	// test is set for test deliveries, see TestDelivery
+	test bool
+}
+
+var errDeliveriesClosed = errors.New("delivery channel closed by RabbitMQ")
+
+// Delay before re-opening a channel that failed while its connection stayed
+// up, eg: the queue was deleted from the management UI.
+const channelRestartDelay = 5 * time.Second
+
+// NewWebhookConsumer creates the consumer of hook. Without a store, messages
+// redelivered after they were dispatched are dispatched again.
+func NewWebhookConsumer(hook pkg.WebhookConfig, broker *pkg.MsgBroker, store *pkg.Store) (*WebhookConsumer, error) {
+	schema, err := LookupSchema(hook.Schema)
+	if err != nil {
+		return nil, fmt.Errorf("webhook %s: %w", hook.Name, err)
+	}
+	if hook.SchemaVersion > schema.Version {
+		return nil, fmt.Errorf("webhook %s: schema %s has no version %d (current is %d)",
+			hook.Name, schema.Name, hook.SchemaVersion, schema.Version)
+	}
+	fields, err := newFieldPolicy(hook.Fields)
+	if err != nil {
+		return nil, fmt.Errorf("webhook %s: %w", hook.Name, err)
+	}
+
+	rules := slices.Clone(schema.rules)
+	for _, rule := range hook.Rules {
+		parsed, err := parseRules(rule.Field, rule.Rule)
+		if err != nil {
+			return nil, fmt.Errorf("webhook %s: field %s: %w", hook.Name, rule.Field, err)
+		}
+		rules = append(rules, parsed...)
+	}
+
+	client := newHTTPClient(hook.Timeouts)
+	destinations, err := newDestinations(hook, client)
+	if err != nil {
+		return nil, fmt.Errorf("webhook %s: %w", hook.Name, err)
+	}
+	routes, err := newRoutes(hook.Routes, destinations)
+	if err != nil {
+		return nil, fmt.Errorf("webhook %s: %w", hook.Name, err)
+	}
+
+	return &WebhookConsumer{
+		hook:         hook,
+		schema:       schema,
+		rules:        rules,
+		fields:       fields,
+		destinations: destinations,
+		routes:       routes,
+		broker:       broker,
+		store:        store,
+		client:       client,
+	}, nil
+}
+
+func (c *WebhookConsumer) Name() string {
+	return c.hook.Name
+}
+
+// prepare decodes, validates and renders d once for all of its destinations.
+// Every error it returns is a *payloadError.
+func (c *WebhookConsumer) prepare(d amqp.Delivery) (*message, error) {
+	payload, err := c.decode(d)
+	if err != nil {
+		return nil, err
+	}
+
+	// Rules and routes see fields in their canonical form, after the schema
+	// normalized them, and before field policies rewrote them.
+	canonical, err := json.Marshal(payload)
+	if err != nil {
+		return nil, &payloadError{reason: ReasonUnparseable, err: err}
+	}
+	doc, err := decodeDocument(canonical)
+	if err != nil {
+		return nil, &payloadError{reason: ReasonUnparseable, err: err}
+	}
+
+	if err := c.validate(doc); err != nil {
+		pkg.Log.Error("Message failed validation", err)
+		return nil, err
+	}
+
+	body, err := c.render(payload)
+	if err != nil {
+		pkg.Log.Error("Failed to render outgoing payload", err)
+		return nil, err
+	}
+
+	// A retry keeps to the destinations it is pending for
+	targets := c.targets(doc)
+	var dests []*destination
+	for _, dest := range c.pendingDestinations(d) {
+		if slices.Contains(targets, dest) {
+			dests = append(dests, dest)
+		}
+	}
+
+	return &message{
+		body:         body,
+		description:  c.fields.describe(payload, body),
+		key:          idempotencyKey(d),
+		attempt:      deliveryAttempts(d) + 1,
+		destinations: dests,
+	}, nil
+}
+
+// decode brings d up to the current schema version of the webhook and decodes
+// it into the schema's payload type.
+func (c *WebhookConsumer) decode(d amqp.Delivery) (Payload, error) {
+	version, err := messageVersion(d, c.hook.SchemaVersion)
+	if err != nil {
+		pkg.Log.Error("Message has an invalid schema version", err)
+		return nil, &payloadError{reason: ReasonUnknownVersion, err: err}
+	}
+
+	payload, err := c.schema.Decode(d.Body, version)
+	if errors.Is(err, ErrUnknownVersion) {
+		pkg.Log.Error("Message has an unknown schema version", err)
+		return nil, &payloadError{reason: ReasonUnknownVersion, err: err}
+	}
+	if err != nil {
+		// Cannot retry this error. The message is parked in the DLQ so that
+		// it can be inspected and handled manually.
+		pkg.Log.Error("Failed to unmarshal message body", err)
+		return nil, &payloadError{
+			reason: ReasonUnparseable,
+			err:    fmt.Errorf("failed to unmarshal message: %w", err),
+		}
+	}
+	return payload, nil
+}
+
+// validate checks the canonical document of a payload against the rules of
+// the webhook. Messages breaking any rule are never retried.
+func (c *WebhookConsumer) validate(doc any) error {
+	violations := validateDocument(doc, c.rules)
+	if len(violations) == 0 {
+		return nil
+	}
+
+	return &payloadError{
+		reason:  ReasonInvalid,
+		err:     fmt.Errorf("payload violates %d rules: %s", len(violations), strings.Join(violations, "; ")),
+		details: violations,
+	}
+}
+
+// render turns a decoded payload into the body sent to the receivers, before
+// their transforms. Field policies run here, so transforms only ever see
+// values that are allowed to leave the service.
+func (c *WebhookConsumer) render(payload Payload) ([]byte, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, &payloadError{reason: ReasonFieldPolicy, err: fmt.Errorf("failed to marshal payload: %w", err)}
+	}
+
+	body, err = c.fields.apply(body)
+	if err != nil {
+		return nil, &payloadError{reason: ReasonFieldPolicy, err: fmt.Errorf("failed to apply field policy: %w", err)}
+	}
+	// Logged before the transforms, whose output has no field paths to redact
+	pkg.Log.Debug(fmt.Sprintf("Outgoing body for %s: %s", c.hook.Name, c.fields.redact(body)))
+	return body, nil
+}
+
+// DryRun renders the requests the webhook would send for a message with the
+// given body and AMQP headers, one per destination it is routed to, without
+// sending them. The requests are signed and authenticated like real ones,
+// which fetches a token for OAuth2 destinations, but the credentials are
+// masked so that they can be printed.
+func (c *WebhookConsumer) DryRun(body []byte, headers amqp.Table) ([]*http.Request, error) {
+	d := amqp.Delivery{Body: body, Headers: headers}
+
+	msg, err := c.prepare(d)
+	if err != nil {
+		return nil, err
+	}
+
+	var requests []*http.Request
+	for _, dest := range msg.destinations {
+		out, err := dest.render(msg)
+		if err != nil {
+			return nil, fmt.Errorf("destination %s: %w", dest.name, err)
+		}
+		req, err := c.newRequest(context.Background(), dest, out)
+		if err != nil {
+			return nil, fmt.Errorf("destination %s: %w", dest.name, err)
+		}
+		masked := []string{"Authorization"}
+		if dest.auth != nil {
+			masked = append(masked, dest.auth.credentialHeader())
+		}
+		for _, name := range masked {
+			if req.Header.Get(name) != "" {
+				req.Header.Set(name, "[REDACTED]")
+			}
+		}
+		requests = append(requests, req)
+	}
+	return requests, nil
+}
+
+// Listen consumes until ctx is cancelled. The consumer survives broker
+// outages: whenever its connection generation is lost it waits for the broker
+// to reconnect and resumes on the new connection.
+func (c *WebhookConsumer) Listen(ctx context.Context) error {
+	for {
+		gen, err := c.broker.Generation(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				pkg.Log.Info(fmt.Sprintf("Shutting down %s consumer...", c.hook.Name))
+				return nil
+			}
+			return err
+		}
+
+		err = c.consume(ctx, gen)
+		if ctx.Err() != nil {
+			pkg.Log.Info(fmt.Sprintf("Shutting down %s consumer...", c.hook.Name))
+			return nil
+		}
+		pkg.Log.Error(fmt.Sprintf("%s consumer interrupted on connection #%d, restarting", c.hook.Name, gen.ID), err)
+
+		select {
+		case <-gen.Lost():
+			// Broker is reconnecting, next Generation call waits for it
+		case <-time.After(channelRestartDelay):
+		case <-ctx.Done():
+			pkg.Log.Info(fmt.Sprintf("Shutting down %s consumer...", c.hook.Name))
+			return nil
+		}
+	}
+}
+
+// handle delivers d to every destination it is pending for and settles it:
+// acked once each destination accepted it or got its own dead-lettered copy
+// (when it rejected the message for good or ran out of retries), moved to a
+// retry queue for the destinations that failed transiently, and dead-lettered
+// as a whole when it cannot be rendered at all. With a partition key the
+// retries are waited out in the worker instead, so that later messages with
+// the same key cannot overtake d.
+func (c *WebhookConsumer) handle(ctx context.Context, ch *amqp.Channel, d amqp.Delivery) {
+	attempt := deliveryAttempts(d) + 1
+
+	msg, err := c.prepare(d)
+	if err != nil {
+		reason, _ := DeadLetterReason(err)
+		pkg.Log.Error("Error processing message, will not retry", err)
+		c.deadLetter(ch, d, reason, attempt, err)
+		return
+	}
+	if len(msg.destinations) == 0 {
+		pkg.Log.Info(fmt.Sprintf("Message %s matched no destination of %s, acknowledging it", d.MessageId, c.hook.Name))
+		d.Ack(false)
+		return
+	}
+
+	pending := c.undelivered(msg.key, msg.destinations)
+	for {
+		retry, attempted := c.attempt(ctx, ch, d, msg, pending, attempt)
+		if len(retry) == 0 {
+			pkg.Log.Info(fmt.Sprintf("Acknowledging message: %s", d.MessageId))
+			d.Ack(false)
+			return
+		}
+		if !attempted {
+			// Shutting down while every failed destination waited for
+			// its circuit or rate limit. Destinations that accepted the
+			// message were recorded in the store and are skipped when it
+			// comes back.
+			pkg.Log.Info(fmt.Sprintf("Requeueing message %s, its destinations were not attempted", d.MessageId))
+			d.Nack(false, true)
+			return
+		}
+		if c.hook.PartitionKey == "" {
+			c.scheduleRetry(ch, d, attempt, retry)
+			return
+		}
+
+		_, delay, ok := c.nextRetry(d, attempt, retry)
+		if !ok {
+			c.scheduleRetry(ch, d, attempt, retry)
+			return
+		}
+		pkg.Log.Info(fmt.Sprintf("Attempt %d for message %s failed for %d destinations, retrying in %s to keep its partition in order",
+			attempt, d.MessageId, len(retry), delay))
+		if waitFor(ctx, nil, delay) != nil {
+			// Requeued messages keep their place in the queue, so the
+			// order holds across restarts
+			pkg.Log.Info(fmt.Sprintf("Requeueing message %s, shutting down while it waited for a retry", d.MessageId))
+			d.Nack(false, true)
+			return
+		}
+
+		attempt++
+		msg.attempt = attempt
+		pending = make([]*destination, 0, len(retry))
+		for _, f := range retry {
+			pending = append(pending, f.dest)
+		}
+	}
+}
+
+// attempt delivers msg to the pending destinations once and dead-letters a
+// copy for each one that rejected it for good or ran out of retries. It
+// returns the failures worth retrying, and whether any destination was
+// actually attempted.
+func (c *WebhookConsumer) attempt(ctx context.Context, ch *amqp.Channel, d amqp.Delivery, msg *message, pending []*destination, attempt int) ([]failure, bool) {
+	errs := c.deliver(ctx, pending, msg)
+
+	var retry []failure
+	attempted := false
+	for i, dest := range pending {
+		err := errs[i]
+		if err == nil {
+			continue
+		}
+		if errors.Is(err, errNotAttempted) {
+			retry = append(retry, failure{dest: dest, err: err})
+			continue
+		}
+		attempted = true
+
+		reason, permanent := DeadLetterReason(err)
+		if !permanent && retriesExhausted(c.hook.Retry, attempt) {
+			reason = ReasonRetriesExhausted
+		}
+		// A copy that could not be dead-lettered is tried again instead
+		if reason != "" && c.publishDeadLetter(ch, d, dest, reason, attempt, err) == nil {
+			continue
+		}
+		retry = append(retry, failure{dest: dest, err: err})
+	}
+	return retry, attempted
+}
+
+// consume runs a single channel on gen until ctx is cancelled or the channel
+// goes away.
+func (c *WebhookConsumer) consume(ctx context.Context, gen *pkg.Generation) error {
+	ch, err := gen.Conn.Channel()
+	if err != nil {
+		return fmt.Errorf("failed to open a channel: %w", err)
+	}
+	defer ch.Close()
+
+	// Retries and dead-letters are published on this channel, confirms make
+	// sure the copy was stored before the original is acked.
+	if err := ch.Confirm(false); err != nil {
+		return fmt.Errorf("failed to put channel into confirm mode: %w", err)
+	}
+
+	// RabbitMQ pushes at most this many unacked messages to the channel, which
+	// keeps every worker busy without buffering the whole queue in memory.
+	if err := ch.Qos(c.hook.Prefetch, 0, false); err != nil {
+		return fmt.Errorf("failed to set prefetch count: %w", err)
+	}
+
+	// The queue itself is declared by pkg.MsgBroker on every (re)connect from
+	// the same configuration, so only consume here.
+	consumerTag := fmt.Sprintf("termite-%s-%d", c.hook.Name, gen.ID)
+	msgs, err := ch.Consume(
+		c.hook.Queue, // queue
+		consumerTag,  // consumer
+		false,        // auto-ack
+		false,        // exclusive
+		false,        // no-local
+		false,        // no-wait
+		nil,          // args
+	)
+	if err != nil {
+		return fmt.Errorf("failed to register a consumer: %w", err)
+	}
+
+	// Drain: in-flight deliveries are finished and settled before the
+	// channel is closed by the deferred ch.Close above.
+	pool := c.startWorkers(ctx, ch)
+	defer pool.stop()
+
+	pkg.Log.Info(fmt.Sprintf("[*] Waiting for messages on %s with %d workers (connection #%d).",
+		c.hook.Queue, c.hook.Workers, gen.ID))
+
+	for {
+		// Nothing is taken from the queue while a destination is down
+		if !c.waitForCircuits(ctx) {
+			c.stopConsuming(ch, consumerTag, msgs)
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			c.stopConsuming(ch, consumerTag, msgs)
+			return nil
+		case d, ok := <-msgs:
+			if !ok {
+				return errDeliveriesClosed
+			}
+			pkg.Log.Info(fmt.Sprintf("Received a message from %s", c.hook.Queue))
+
+			if !pool.submit(ctx, d) {
+				// Every worker is busy and we are shutting down
+				d.Nack(false, true) // Re-queue the message
+			}
+		}
+	}
+}
+
+// stopConsuming cancels the consumer so that RabbitMQ stops pushing messages
+// and requeues everything that was prefetched but not handed to a worker.
+func (c *WebhookConsumer) stopConsuming(ch *amqp.Channel, consumerTag string, msgs <-chan amqp.Delivery) {
+	pkg.Log.Info(fmt.Sprintf("Draining %s consumer...", c.hook.Name))
+	if err := ch.Cancel(consumerTag, false); err != nil {
+		// Channel is gone, RabbitMQ requeues unacked messages on its own
+		return
+	}
+	for d := range msgs {
+		d.Nack(false, true) // Re-queue the message
+	}
+}
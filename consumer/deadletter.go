@@ -0,0 +1,92 @@
+package consumer
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/IAmRiteshKoushik/termite/pkg"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Headers attached to every dead-lettered message so that whoever inspects the
+// DLQ can tell why it ended up there.
+const (
+	HeaderReason     = "x-termite-reason"
+	HeaderAttempts   = "x-termite-attempts"
+	HeaderLastStatus = "x-termite-last-status"
+	HeaderError      = "x-termite-error"
+	HeaderWebhook    = "x-termite-webhook"
+	HeaderQueue      = "x-termite-queue"
+	HeaderFailedAt   = "x-termite-failed-at"
+	HeaderViolations = "x-termite-violations"
+
+	// HeaderDestination names the destination a dead-lettered copy failed
+	// for. HeaderPending lists the destinations a message still has to reach
+	// and is set on retries and dead-lettered copies alike.
+	HeaderDestination = "x-termite-destination"
+	HeaderPending     = "x-termite-pending"
+)
+
+// Values of HeaderReason
+const (
+	ReasonUnparseable      = "unparseable"
+	ReasonRetriesExhausted = "retries-exhausted"
+	ReasonFieldPolicy      = "field-policy"
+	ReasonInvalid          = "invalid"
+	ReasonUnknownVersion   = "unknown-version"
+	ReasonTransform        = "transform"
+	ReasonRejected         = "rejected"
+)
+
+// deadLetter publishes d to the dead-letter exchange together with the reason
+// of the failure and acks the original. If the publish does not go through,
+// the message is rejected instead and RabbitMQ dead-letters it on its own,
+// only without the failure headers.
+func (c *WebhookConsumer) deadLetter(ch *amqp.Channel, d amqp.Delivery, reason string, attempts int, cause error) {
+	if err := c.publishDeadLetter(ch, d, nil, reason, attempts, cause); err != nil {
+		d.Nack(false, false)
+		return
+	}
+	d.Ack(false)
+}
+
+// publishDeadLetter publishes a copy of d to the dead-letter exchange. With
+// dest set the copy only stands for that destination: replaying it delivers
+// to dest alone. d itself is left unsettled.
+func (c *WebhookConsumer) publishDeadLetter(ch *amqp.Channel, d amqp.Delivery, dest *destination, reason string, attempts int, cause error) error {
+	headers := copyHeaders(d.Headers)
+	headers[HeaderReason] = reason
+	headers[HeaderAttempts] = attempts
+	headers[HeaderLastStatus] = lastStatus(cause)
+	headers[HeaderError] = cause.Error()
+	headers[HeaderWebhook] = c.hook.Name
+	headers[HeaderQueue] = c.hook.Queue
+	headers[HeaderFailedAt] = time.Now().UTC().Format(time.RFC3339)
+
+	target := c.hook.Queue
+	if dest != nil {
+		headers[HeaderDestination] = dest.name
+		headers[HeaderPending] = []any{dest.name}
+		target = fmt.Sprintf("%s (destination %s)", c.hook.Queue, dest.name)
+	}
+
+	var payload *payloadError
+	if errors.As(cause, &payload) && len(payload.details) > 0 {
+		details := make([]any, len(payload.details))
+		for i, detail := range payload.details {
+			details[i] = detail
+		}
+		headers[HeaderViolations] = details
+	}
+
+	err := publishConfirmed(ch, pkg.DeadLetterExchange, c.hook.Queue, republishing(d, headers))
+	if err != nil {
+		pkg.Log.Error(fmt.Sprintf("Failed to dead-letter message %s from %s", d.MessageId, target), err)
+		return err
+	}
+
+	pkg.Log.Warn(fmt.Sprintf("Message %s from %s moved to %s (%s): %v",
+		d.MessageId, target, pkg.DeadLetterQueue(c.hook.Queue), reason, cause))
+	return nil
+}
@@ -0,0 +1,195 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/IAmRiteshKoushik/termite/pkg"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"golang.org/x/time/rate"
+)
+
+// errNotAttempted is returned for deliveries that were not sent because the
+// consumer shut down while they waited for an open circuit or the rate limit.
+// They do not count as an attempt.
+var errNotAttempted = errors.New("not attempted")
+
+// destination is one receiver of a webhook's messages.
+type destination struct {
+	name      string
+	url       string
+	transform *transform
+	// nil when circuit breaking is disabled
+	breaker *breaker
+	// nil without a rate limit
+	limiter *rate.Limiter
+	// nil when requests go out without credentials
+	auth authenticator
+}
+
+// failure is a failed delivery to one destination.
+type failure struct {
+	dest *destination
+	err  error
+}
+
+func newDestinations(hook pkg.WebhookConfig, client *http.Client) ([]*destination, error) {
+	dests := make([]*destination, 0, len(hook.Destinations))
+	for _, cfg := range hook.Destinations {
+		transformConfig := hook.Transform
+		if cfg.Transform != nil {
+			transformConfig = *cfg.Transform
+		}
+		transform, err := newTransform(transformConfig)
+		if err != nil {
+			return nil, fmt.Errorf("destination %s: %w", cfg.Name, err)
+		}
+		dest := &destination{name: cfg.Name, url: cfg.URL, transform: transform}
+		if !hook.CircuitBreaker.Disabled {
+			dest.breaker = newBreaker(hook.Name+"/"+cfg.Name, hook.CircuitBreaker)
+		}
+		limit := hook.RateLimit
+		if cfg.RateLimit != nil {
+			limit = *cfg.RateLimit
+		}
+		dest.limiter = newLimiter(limit)
+		auth := hook.Auth
+		if cfg.Auth != nil {
+			auth = *cfg.Auth
+		}
+		dest.auth = newAuthenticator(auth, client)
+		dests = append(dests, dest)
+	}
+	return dests, nil
+}
+
+// newLimiter returns the token bucket for limit, nil if it is unlimited.
+func newLimiter(limit pkg.RateLimitConfig) *rate.Limiter {
+	if limit.RequestsPerSecond == 0 {
+		return nil
+	}
+	burst := limit.Burst
+	if burst == 0 {
+		burst = int(math.Ceil(limit.RequestsPerSecond))
+	}
+	return rate.NewLimiter(rate.Limit(limit.RequestsPerSecond), burst)
+}
+
+func (c *WebhookConsumer) destination(name string) *destination {
+	for _, dest := range c.destinations {
+		if dest.name == name {
+			return dest
+		}
+	}
+	return nil
+}
+
+// pendingDestinations returns the destinations d still has to be delivered to.
+// A message gets HeaderPending once it was tried, so destinations that already
+// accepted it are not sent it again by a retry.
+func (c *WebhookConsumer) pendingDestinations(d amqp.Delivery) []*destination {
+	value, ok := d.Headers[HeaderPending]
+	if !ok {
+		return c.destinations
+	}
+
+	names, _ := value.([]any)
+	pending := make([]*destination, 0, len(names))
+	for _, name := range names {
+		dest := c.destination(fieldString(name))
+		if dest == nil {
+			// Removed from env.toml since the message was first tried
+			pkg.Log.Warn(fmt.Sprintf("Message %s is pending for unknown destination %s of %s, skipping it",
+				d.MessageId, fieldString(name), c.hook.Name))
+			continue
+		}
+		pending = append(pending, dest)
+	}
+	return pending
+}
+
+// deliver sends msg to all dests in parallel and returns the error of every
+// destination, in the order of dests.
+func (c *WebhookConsumer) deliver(ctx context.Context, dests []*destination, msg *message) []error {
+	errs := make([]error, len(dests))
+	var wg sync.WaitGroup
+	for i, dest := range dests {
+		wg.Go(func() {
+			errs[i] = c.deliverTo(ctx, dest, msg)
+		})
+	}
+	wg.Wait()
+	return errs
+}
+
+func (c *WebhookConsumer) deliverTo(ctx context.Context, dest *destination, msg *message) error {
+	out, err := dest.render(msg)
+	if err != nil {
+		pkg.Log.Error(fmt.Sprintf("Failed to render request for destination %s", dest.name), err)
+		return err
+	}
+
+	// Test deliveries neither wait for nor affect the circuit
+	if dest.breaker != nil && !msg.test {
+		if err := dest.breaker.acquire(ctx); err != nil {
+			return err
+		}
+		defer func() { dest.breaker.record(err) }()
+	}
+	if dest.limiter != nil {
+		if waitErr := dest.limiter.Wait(ctx); waitErr != nil {
+			err = fmt.Errorf("%w: waiting for the rate limit of %s: %v", errNotAttempted, dest.name, waitErr)
+			return err
+		}
+	}
+
+	// The request outlives ctx by the grace period, so that shutting down
+	// does not cut off receivers that are about to answer
+	dispatchCtx, cancel := withGrace(ctx, c.hook.Timeouts.ShutdownGrace)
+	defer cancel()
+	err = c.dispatch(dispatchCtx, dest, out)
+	if err != nil {
+		// Dispatch failures could be attributed to bad network conditions or
+		// listener failures on the other end. The retry policy decides if and
+		// when to try again.
+		pkg.Log.Warn(fmt.Sprintf("Dispatch to %s failed: %v", dest.name, err))
+		return err
+	}
+	c.markDelivered(msg.key, dest)
+	return nil
+}
+
+// render applies the transform of dest to msg.
+func (dest *destination) render(msg *message) (*outgoing, error) {
+	out, err := dest.transform.apply(msg.body)
+	if err != nil {
+		return nil, &payloadError{reason: ReasonTransform, err: fmt.Errorf("failed to apply transform: %w", err)}
+	}
+	out.description = msg.description
+	out.idempotencyKey = msg.key
+	out.attempt = msg.attempt
+	return out, nil
+}
+
+// pendingHeader encodes the destinations of failures for HeaderPending.
+func pendingHeader(failures []failure) []any {
+	names := make([]any, len(failures))
+	for i, f := range failures {
+		names[i] = f.dest.name
+	}
+	return names
+}
+
+// failureMessage joins the errors of failures into one line for HeaderError.
+func failureMessage(failures []failure) string {
+	messages := make([]string, len(failures))
+	for i, f := range failures {
+		messages[i] = f.dest.name + ": " + f.err.Error()
+	}
+	return strings.Join(messages, "; ")
+}
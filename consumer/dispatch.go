@@ -0,0 +1,199 @@
+package consumer
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/IAmRiteshKoushik/termite/pkg"
+)
+
+// How much of a response body ends up in the delivery log
+const responseExcerptSize = 1024
+
+// Cap for Retry-After in seconds, so that a bogus header cannot overflow
+const maxRetryAfter = 7 * 24 * 60 * 60
+
+// newHTTPClient returns the client dispatches of a webhook go through.
+func newHTTPClient(timeouts pkg.TimeoutConfig) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{
+		Timeout:   timeouts.Connect,
+		KeepAlive: 30 * time.Second,
+	}).DialContext
+	transport.TLSHandshakeTimeout = timeouts.TLS
+	transport.ResponseHeaderTimeout = timeouts.ResponseHeader
+	return &http.Client{Transport: transport, Timeout: timeouts.Total}
+}
+
+// withGrace returns a context that is cancelled grace after ctx is, so that
+// requests in flight at shutdown get a chance to finish.
+func withGrace(ctx context.Context, grace time.Duration) (context.Context, context.CancelFunc) {
+	graceCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	stop := context.AfterFunc(ctx, func() {
+		timer := time.AfterFunc(grace, cancel)
+		context.AfterFunc(graceCtx, func() { timer.Stop() })
+	})
+	return graceCtx, func() {
+		stop()
+		cancel()
+	}
+}
+
+// parseRetryAfter reads a Retry-After header, which is either a number of
+// seconds or an HTTP date. Missing, malformed and past values yield 0.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		if seconds <= 0 {
+			return 0
+		}
+		return time.Duration(min(seconds, maxRetryAfter)) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil && date.After(now) {
+		return min(date.Sub(now), maxRetryAfter*time.Second)
+	}
+	return 0
+}
+
+// newRequest builds the authenticated and signed POST for out. For OAuth2
+// destinations this may fetch a token, a failure to get one is a
+// *networkError. Signing comes last so that the signature covers the final
+// body.
+func (c *WebhookConsumer) newRequest(ctx context.Context, dest *destination, out *outgoing) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", dest.url, bytes.NewBuffer(out.body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	for name, values := range out.headers {
+		req.Header[name] = values
+	}
+	req.Header.Set("Content-Type", out.contentType)
+	req.Header.Set(HeaderIdempotencyKey, out.idempotencyKey)
+	if dest.auth != nil {
+		if err := dest.auth.authenticate(req); err != nil {
+			return nil, &networkError{err: err}
+		}
+	}
+	signRequest(req, out.body, c.hook.Signing.Secrets, time.Now())
+	return req, nil
+}
+
+// dispatch POSTs the rendered request to the URL of dest and logs the attempt
+// in the store. Failures are a *networkError, a *retryableStatusError or a
+// *permanentStatusError, according to the status_codes of the webhook, except
+// that a 401 from an OAuth2 destination is always retried with a new token. Once
+// ctx is cancelled the request is aborted and errNotAttempted returned.
+func (c *WebhookConsumer) dispatch(ctx context.Context, dest *destination, out *outgoing) error {
+	description := out.description
+	pkg.Log.Info(fmt.Sprintf("Dispatching payload for %s to %s", description, dest.name))
+
+	start := time.Now()
+	req, err := c.newRequest(ctx, dest, out)
+	if err != nil && ctx.Err() != nil {
+		return c.aborted(dest, out, start, err)
+	}
+	if err != nil {
+		pkg.Log.Error("Failed to create HTTP request", err)
+		c.recordAttempt(dest, out, start, 0, nil, err)
+		return err
+	}
+
+	// Dispatch the request
+	resp, err := c.client.Do(req)
+	if err != nil && ctx.Err() != nil {
+		return c.aborted(dest, out, start, err)
+	}
+	if err != nil {
+		pkg.Log.Error("Failed to dispatch payload", err)
+		err = &networkError{err: err}
+		c.recordAttempt(dest, out, start, 0, nil, err)
+		return err
+	}
+	defer resp.Body.Close()
+	excerpt, _ := io.ReadAll(io.LimitReader(resp.Body, responseExcerptSize))
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		pkg.Log.Info(fmt.Sprintf("Successfully dispatched payload for %s to %s, status: %s", description, dest.name, resp.Status))
+		c.recordAttempt(dest, out, start, resp.StatusCode, excerpt, nil)
+		return nil
+	}
+
+	status := &statusError{
+		StatusCode: resp.StatusCode,
+		Status:     resp.Status,
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+	}
+	action := c.hook.StatusCodes.Action(resp.StatusCode)
+	oauth, isOAuth2 := dest.auth.(*oauth2Auth)
+	switch {
+	case isOAuth2 && resp.StatusCode == http.StatusUnauthorized:
+		// The token may have been revoked before it expired, the retry
+		// goes out with a new one whatever the mapping says
+		oauth.invalidate()
+		err = &retryableStatusError{status}
+	case action == pkg.StatusActionAck:
+		pkg.Log.Info(fmt.Sprintf("Dispatched payload for %s to %s, status %s counts as delivered", description, dest.name, resp.Status))
+		c.recordAttempt(dest, out, start, resp.StatusCode, excerpt, nil)
+		return nil
+	case action == pkg.StatusActionDeadLetter:
+		err = &permanentStatusError{status}
+	default:
+		err = &retryableStatusError{status}
+	}
+
+	pkg.Log.Warn(fmt.Sprintf("Failed to dispatch payload for %s to %s, status: %s", description, dest.name, resp.Status))
+	c.recordAttempt(dest, out, start, resp.StatusCode, excerpt, err)
+	return err
+}
+
+// aborted records a dispatch to dest that was given up on because of shutdown
+// and returns err wrapped in errNotAttempted.
+func (c *WebhookConsumer) aborted(dest *destination, out *outgoing, start time.Time, err error) error {
+	err = fmt.Errorf("%w: request to %s aborted by shutdown: %v", errNotAttempted, dest.name, err)
+	pkg.Log.Warn(err.Error())
+	c.recordAttempt(dest, out, start, 0, nil, err)
+	return err
+}
+
+// recordAttempt adds a dispatch that started at start to the delivery log. A
+// failure to log never fails the delivery itself.
+func (c *WebhookConsumer) recordAttempt(dest *destination, out *outgoing, start time.Time, status int, response []byte, cause error) {
+	if c.store == nil {
+		return
+	}
+
+	sum := sha256.Sum256(out.body)
+	attempt := pkg.Attempt{
+		Webhook:     c.hook.Name,
+		Destination: dest.name,
+		MessageID:   out.idempotencyKey,
+		Description: out.description,
+		Attempt:     out.attempt,
+		BodySHA256:  hex.EncodeToString(sum[:]),
+		Status:      status,
+		Response:    strings.ToValidUTF8(string(response), ""),
+		Latency:     time.Since(start),
+		AttemptedAt: start,
+	}
+	if cause != nil {
+		attempt.Error = cause.Error()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), storeTimeout)
+	defer cancel()
+	if err := c.store.RecordAttempt(ctx, attempt); err != nil {
+		pkg.Log.Error(fmt.Sprintf("Failed to log attempt for %s to %s", out.idempotencyKey, dest.name), err)
+	}
+}
@@ -0,0 +1,116 @@
+package consumer
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Failures of a delivery fall into four kinds, which decide what happens to
+// the message:
+//
+//   - networkError: no response at all, retried
+//   - retryableStatusError: a response the status_codes mapping retries
+//   - permanentStatusError: a response the mapping dead-letters
+//   - payloadError: the message itself is broken, dead-lettered before any
+//     dispatch
+//
+// Responses the mapping acks are not errors at all.
+
+// networkError is a dispatch that got no response, eg: the receiver is down
+// or timed out.
+type networkError struct {
+	err error
+}
+
+func (e *networkError) Error() string {
+	return fmt.Sprintf("failed to dispatch request: %v", e.err)
+}
+
+func (e *networkError) Unwrap() error {
+	return e.err
+}
+
+// statusError is a non-2xx response. RetryAfter is how long the receiver
+// asked us to wait through its Retry-After header, 0 if it did not. It is only
+// ever returned wrapped in a retryableStatusError or permanentStatusError.
+type statusError struct {
+	StatusCode int
+	Status     string
+	RetryAfter time.Duration
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("request failed with status: %s", e.Status)
+}
+
+// retryableStatusError is a response worth trying again, eg: a 503.
+type retryableStatusError struct {
+	*statusError
+}
+
+func (e *retryableStatusError) Unwrap() error {
+	return e.statusError
+}
+
+// permanentStatusError is a response retrying cannot change, eg: a 400 for a
+// payload the receiver does not accept.
+type permanentStatusError struct {
+	*statusError
+}
+
+func (e *permanentStatusError) Unwrap() error {
+	return e.statusError
+}
+
+// payloadError marks a message that cannot be decoded, validated or rendered.
+// Retrying cannot fix it, so it is dead-lettered straight away.
+type payloadError struct {
+	reason string
+	err    error
+
+	// details end up in HeaderViolations, eg: the violated validation rules
+	details []string
+}
+
+func (e *payloadError) Error() string {
+	return e.err.Error()
+}
+
+func (e *payloadError) Unwrap() error {
+	return e.err
+}
+
+// DeadLetterReason returns the HeaderReason to dead-letter with when err is
+// permanent, and false when it is worth retrying.
+func DeadLetterReason(err error) (string, bool) {
+	var payload *payloadError
+	if errors.As(err, &payload) {
+		return payload.reason, true
+	}
+	var status *permanentStatusError
+	if errors.As(err, &status) {
+		return ReasonRejected, true
+	}
+	return "", false
+}
+
+// lastStatus extracts the HTTP status code from a dispatch error, 0 when the
+// request never got a response.
+func lastStatus(err error) int {
+	var se *statusError
+	if errors.As(err, &se) {
+		return se.StatusCode
+	}
+	return 0
+}
+
+// retryAfter extracts the wait requested by the receiver from a dispatch
+// error, 0 when there is none.
+func retryAfter(err error) time.Duration {
+	var se *statusError
+	if errors.As(err, &se) {
+		return se.RetryAfter
+	}
+	return 0
+}
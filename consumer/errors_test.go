@@ -0,0 +1,42 @@
+package consumer
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestDeadLetterReason(t *testing.T) {
+	status := &statusError{StatusCode: 503, Status: "503 Service Unavailable", RetryAfter: time.Minute}
+
+	tests := []struct {
+		name          string
+		err           error
+		wantReason    string
+		wantPermanent bool
+		wantStatus    int
+		wantAfter     time.Duration
+	}{
+		{"network", &networkError{err: errors.New("connection refused")}, "", false, 0, 0},
+		{"retryable status", &retryableStatusError{status}, "", false, 503, time.Minute},
+		{"permanent status", &permanentStatusError{&statusError{StatusCode: 400, Status: "400 Bad Request"}}, ReasonRejected, true, 400, 0},
+		{"payload", &payloadError{reason: ReasonInvalid, err: errors.New("email: required")}, ReasonInvalid, true, 0, 0},
+		{"wrapped", fmt.Errorf("destination portal: %w", &retryableStatusError{status}), "", false, 503, time.Minute},
+		{"not attempted", fmt.Errorf("%w: circuit of portal is open", errNotAttempted), "", false, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reason, permanent := DeadLetterReason(tt.err)
+			if reason != tt.wantReason || permanent != tt.wantPermanent {
+				t.Errorf("DeadLetterReason = %q, %t, want %q, %t", reason, permanent, tt.wantReason, tt.wantPermanent)
+			}
+			if got := lastStatus(tt.err); got != tt.wantStatus {
+				t.Errorf("lastStatus = %d, want %d", got, tt.wantStatus)
+			}
+			if got := retryAfter(tt.err); got != tt.wantAfter {
+				t.Errorf("retryAfter = %s, want %s", got, tt.wantAfter)
+			}
+		})
+	}
+}
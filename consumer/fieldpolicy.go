@@ -0,0 +1,200 @@
+package consumer
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/IAmRiteshKoushik/termite/pkg"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const redacted = "[REDACTED]"
+
+// Argon2id parameters, the second recommended option of RFC 9106
+const (
+	argon2Time    = 3
+	argon2Memory  = 64 * 1024
+	argon2Threads = 4
+	argon2KeyLen  = 32
+	argon2SaltLen = 16
+)
+
+// fieldRule is a compiled `[[webhooks.fields]]` entry.
+type fieldRule struct {
+	pkg.FieldConfig
+	publicKey *rsa.PublicKey
+}
+
+// fieldPolicy decides what happens to individual payload fields before a
+// message leaves the service: sensitive values are kept out of logs and can be
+// dropped, hashed or encrypted in the outgoing body.
+type fieldPolicy struct {
+	rules []fieldRule
+}
+
+func newFieldPolicy(fields []pkg.FieldConfig) (*fieldPolicy, error) {
+	policy := &fieldPolicy{}
+	for _, field := range fields {
+		rule := fieldRule{FieldConfig: field}
+		if field.Action == pkg.FieldActionEncrypt {
+			key, err := loadPublicKey(field.PublicKey)
+			if err != nil {
+				return nil, fmt.Errorf("field %s: %w", field.Path, err)
+			}
+			rule.publicKey = key
+		}
+		policy.rules = append(policy.rules, rule)
+	}
+	return policy, nil
+}
+
+// apply rewrites body according to the policy and returns the body to send.
+// A body without rules applying to it is returned untouched.
+func (p *fieldPolicy) apply(body []byte) ([]byte, error) {
+	if !p.rewrites() {
+		return body, nil
+	}
+
+	doc, err := decodeDocument(body)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, rule := range p.rules {
+		err := updateField(doc, rule.Path, func(value any) (any, bool, error) {
+			switch rule.Action {
+			case pkg.FieldActionDrop:
+				return nil, false, nil
+			case pkg.FieldActionHash:
+				hashed, err := hashValue(rule.Hash, fieldString(value))
+				return hashed, true, err
+			case pkg.FieldActionEncrypt:
+				encrypted, err := encryptValue(rule.publicKey, fieldString(value))
+				return encrypted, true, err
+			}
+			return value, true, nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %w", rule.Path, err)
+		}
+	}
+
+	return json.Marshal(doc)
+}
+
+func (p *fieldPolicy) rewrites() bool {
+	for _, rule := range p.rules {
+		if rule.Action != "" && rule.Action != pkg.FieldActionKeep {
+			return true
+		}
+	}
+	return false
+}
+
+// redact returns body with every sensitive field replaced by a placeholder,
+// for logging. Bodies that are not JSON are not logged at all.
+func (p *fieldPolicy) redact(body []byte) string {
+	doc, err := decodeDocument(body)
+	if err != nil {
+		return redacted
+	}
+	for _, rule := range p.rules {
+		if !rule.Sensitive {
+			continue
+		}
+		_ = updateField(doc, rule.Path, func(any) (any, bool, error) {
+			return redacted, true, nil
+		})
+	}
+	encoded, _ := json.Marshal(doc)
+	return string(encoded)
+}
+
+// describe is Payload.Describe with the values of sensitive fields masked, in
+// case the identifier used by the payload type is itself sensitive.
+func (p *fieldPolicy) describe(payload Payload, body []byte) string {
+	description := payload.Describe()
+
+	doc, err := decodeDocument(body)
+	if err != nil {
+		return description
+	}
+	for _, rule := range p.rules {
+		if !rule.Sensitive {
+			continue
+		}
+		_ = updateField(doc, rule.Path, func(value any) (any, bool, error) {
+			if s := fieldString(value); s != "" {
+				description = strings.ReplaceAll(description, s, redacted)
+			}
+			return value, true, nil
+		})
+	}
+	return description
+}
+
+func hashValue(algorithm, value string) (string, error) {
+	switch algorithm {
+	case pkg.FieldHashArgon2id:
+		salt := make([]byte, argon2SaltLen)
+		if _, err := rand.Read(salt); err != nil {
+			return "", err
+		}
+		key := argon2.IDKey([]byte(value), salt, argon2Time, argon2Memory, argon2Threads, argon2KeyLen)
+		// PHC string format, understood by every argon2 library
+		return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+			argon2.Version, argon2Memory, argon2Time, argon2Threads,
+			base64.RawStdEncoding.EncodeToString(salt),
+			base64.RawStdEncoding.EncodeToString(key)), nil
+	default:
+		hashed, err := bcrypt.GenerateFromPassword([]byte(value), bcrypt.DefaultCost)
+		return string(hashed), err
+	}
+}
+
+// encryptValue encrypts value with RSA-OAEP (SHA-256) and returns it base64
+// encoded. The receiver decrypts it with its private key.
+func encryptValue(key *rsa.PublicKey, value string) (string, error) {
+	ciphertext, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, key, []byte(value), nil)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(ciphertext), nil
+}
+
+// loadPublicKey reads an RSA public key from a PEM file, either PKIX
+// ("PUBLIC KEY") or PKCS #1 ("RSA PUBLIC KEY").
+func loadPublicKey(path string) (*rsa.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read public key: %w", err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM block found in %s", path)
+	}
+
+	if block.Type == "RSA PUBLIC KEY" {
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	}
+	parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse public key: %w", err)
+	}
+	key, ok := parsed.(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.New("public key is not an RSA key")
+	}
+	return key, nil
+}
@@ -0,0 +1,139 @@
+package consumer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// decodeDocument decodes a message body without a schema so that fields can be
+// looked up by path. Numbers are kept as json.Number to print them unchanged.
+func decodeDocument(body []byte) (any, error) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+
+	var doc any
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// lookupField walks a dotted path such as "leader_email" or
+// "team_members.0.email" through a decoded document. Numeric segments index
+// into arrays.
+func lookupField(doc any, path string) (any, bool) {
+	current := doc
+	for _, segment := range strings.Split(path, ".") {
+		switch node := current.(type) {
+		case map[string]any:
+			value, ok := node[segment]
+			if !ok {
+				return nil, false
+			}
+			current = value
+		case []any:
+			index, err := strconv.Atoi(segment)
+			if err != nil || index < 0 || index >= len(node) {
+				return nil, false
+			}
+			current = node[index]
+		default:
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// fieldString renders a looked up value for comparisons and hashing. Objects
+// and arrays are rendered as JSON.
+func fieldString(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		return strconv.FormatBool(v)
+	case map[string]any, []any:
+		encoded, _ := json.Marshal(v)
+		return string(encoded)
+	}
+	return fmt.Sprint(value)
+}
+
+// updateField calls fn for every value at path and stores what it returns, or
+// deletes the field when keep is false. A "*" segment matches every element of
+// an array or object (eg: "team_members.*.phone_number"). Paths that do not
+// exist in doc are ignored.
+func updateField(doc any, path string, fn func(value any) (updated any, keep bool, err error)) error {
+	return updateSegments(doc, strings.Split(path, "."), fn)
+}
+
+func updateSegments(node any, segments []string, fn func(any) (any, bool, error)) error {
+	segment, last := segments[0], len(segments) == 1
+
+	switch container := node.(type) {
+	case map[string]any:
+		keys := []string{segment}
+		if segment == "*" {
+			keys = keys[:0]
+			for key := range container {
+				keys = append(keys, key)
+			}
+		}
+		for _, key := range keys {
+			value, ok := container[key]
+			if !ok {
+				continue
+			}
+			if !last {
+				if err := updateSegments(value, segments[1:], fn); err != nil {
+					return err
+				}
+				continue
+			}
+			updated, keep, err := fn(value)
+			if err != nil {
+				return err
+			}
+			if keep {
+				container[key] = updated
+			} else {
+				delete(container, key)
+			}
+		}
+	case []any:
+		indexes := []int{}
+		if segment == "*" {
+			for i := range container {
+				indexes = append(indexes, i)
+			}
+		} else if i, err := strconv.Atoi(segment); err == nil && i >= 0 && i < len(container) {
+			indexes = append(indexes, i)
+		}
+		for _, i := range indexes {
+			if !last {
+				if err := updateSegments(container[i], segments[1:], fn); err != nil {
+					return err
+				}
+				continue
+			}
+			// Array elements cannot be removed without shifting the
+			// others, a dropped element becomes null.
+			updated, keep, err := fn(container[i])
+			if err != nil {
+				return err
+			}
+			if !keep {
+				updated = nil
+			}
+			container[i] = updated
+		}
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package consumer
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/IAmRiteshKoushik/termite/pkg"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// HeaderIdempotencyKey is set on every outgoing request. The key stays the
+// same for every delivery, retry and destination of a message, so receivers
+// can discard a request they have already processed.
+const HeaderIdempotencyKey = "Idempotency-Key"
+
+// Upper bound for a single lookup or insert in the dedup store
+const storeTimeout = 5 * time.Second
+
+// idempotencyKey is the MessageId of d or, for producers that do not set one,
+// a hash of its body.
+func idempotencyKey(d amqp.Delivery) string {
+	if d.MessageId != "" {
+		return d.MessageId
+	}
+	sum := sha256.Sum256(d.Body)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// undelivered drops the destinations that already accepted the message with
+// key, eg: because it was requeued on shutdown after being dispatched. When
+// the store cannot be read the message is dispatched anyway; receivers still
+// have the idempotency key to fall back on.
+func (c *WebhookConsumer) undelivered(key string, dests []*destination) []*destination {
+	if c.store == nil {
+		return dests
+	}
+
+	pending := make([]*destination, 0, len(dests))
+	for _, dest := range dests {
+		ctx, cancel := context.WithTimeout(context.Background(), storeTimeout)
+		delivered, err := c.store.Delivered(ctx, c.hook.Name, dest.name, key)
+		cancel()
+		if err != nil {
+			pkg.Log.Error(fmt.Sprintf("Failed to look up delivery of %s to %s", key, dest.name), err)
+		}
+		if delivered {
+			pkg.Log.Info(fmt.Sprintf("Message %s was already delivered to %s, skipping it", key, dest.name))
+			continue
+		}
+		pending = append(pending, dest)
+	}
+	return pending
+}
+
+// markDelivered records that dest accepted the message with key.
+func (c *WebhookConsumer) markDelivered(key string, dest *destination) {
+	if c.store == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), storeTimeout)
+	defer cancel()
+	if err := c.store.MarkDelivered(ctx, c.hook.Name, dest.name, key); err != nil {
+		pkg.Log.Error(fmt.Sprintf("Failed to record delivery of %s to %s", key, dest.name), err)
+	}
+}
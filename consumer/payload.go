@@ -0,0 +1,129 @@
+package consumer
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Payload is a decoded queue message. Describe returns a short human readable
+// identifier (an email, a team name) that is safe to put in log lines.
+type Payload interface {
+	Describe() string
+}
+
+// Schema ties the `schema` value of a webhook entry in env.toml to the Go type
+// that messages on its queue are decoded into.
+type Schema struct {
+	Name string
+	New  func() Payload
+
+	// Version is the version New decodes. Older messages are brought up to
+	// it by running upgrades[v] for every version v in between.
+	Version  int
+	upgrades map[int]Upgrade
+
+	// rules come from the `validate` tags of the payload type
+	rules []validationRule
+}
+
+// Upgrade rewrites a decoded message of one schema version in place into the
+// shape of the next version.
+type Upgrade func(doc map[string]any) error
+
+var schemas = map[string]*Schema{}
+
+func registerSchema(name string, newPayload func() Payload) {
+	schemas[name] = &Schema{
+		Name:     name,
+		New:      newPayload,
+		Version:  1,
+		upgrades: map[int]Upgrade{},
+		rules:    tagRules(reflect.TypeOf(newPayload()), ""),
+	}
+}
+
+// registerUpgrade adds the upgrade from version `from` to from+1 and makes
+// from+1 the current version. Upgrades are registered in order, right after
+// the schema itself.
+func registerUpgrade(name string, from int, upgrade Upgrade) {
+	schema := schemas[name]
+	if from != schema.Version {
+		panic(fmt.Sprintf("schema %s: upgrade from v%d registered while at v%d", name, from, schema.Version))
+	}
+	schema.upgrades[from] = upgrade
+	schema.Version = from + 1
+}
+
+func LookupSchema(name string) (Schema, error) {
+	schema, ok := schemas[name]
+	if !ok {
+		return Schema{}, fmt.Errorf("unknown payload schema %q (known: %s)", name, strings.Join(SchemaNames(), ", "))
+	}
+	return *schema, nil
+}
+
+func SchemaNames() []string {
+	names := make([]string, 0, len(schemas))
+	for name := range schemas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Decode upgrades a message of the given schema version to the current one and
+// decodes it. Versions the schema does not know fail with ErrUnknownVersion.
+func (s Schema) Decode(body []byte, version int) (Payload, error) {
+	if version < 1 || version > s.Version {
+		return nil, fmt.Errorf("%w: %s v%d (current is v%d)", ErrUnknownVersion, s.Name, version, s.Version)
+	}
+
+	doc, err := decodeDocument(body)
+	if err != nil {
+		return nil, err
+	}
+	object, ok := doc.(map[string]any)
+	if !ok {
+		return nil, errors.New("message is not a JSON object")
+	}
+	// The version is a property of the message, not of the payload
+	delete(object, VersionField)
+
+	for v := version; v < s.Version; v++ {
+		if err := s.upgrades[v](object); err != nil {
+			return nil, fmt.Errorf("failed to upgrade %s v%d to v%d: %w", s.Name, v, v+1, err)
+		}
+	}
+
+	upgraded, err := json.Marshal(object)
+	if err != nil {
+		return nil, err
+	}
+	// Numbers stay json.Number in untyped fields, so that large integers
+	// such as ids are forwarded unchanged
+	decoder := json.NewDecoder(bytes.NewReader(upgraded))
+	decoder.UseNumber()
+	payload := s.New()
+	if err := decoder.Decode(payload); err != nil {
+		return nil, err
+	}
+	return payload, nil
+}
+
+// JSONPayload is used by webhooks that do not need a dedicated Go type. Any
+// JSON object is accepted and forwarded as-is, which lets a new event be added
+// purely through env.toml.
+type JSONPayload map[string]any
+
+func init() {
+	registerSchema("json", func() Payload { return &JSONPayload{} })
+}
+
+func (p *JSONPayload) Describe() string {
+	return fmt.Sprintf("json object with %d fields", len(*p))
+}
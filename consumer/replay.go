@@ -0,0 +1,274 @@
+package consumer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/IAmRiteshKoushik/termite/pkg"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// HeaderReplayedAt is set on messages republished from the dead-letter queue.
+const HeaderReplayedAt = "x-termite-replayed-at"
+
+// Upper bound for the messages read from a dead-letter queue at once. They
+// stay unacked until the scan is over, so this also caps memory use.
+const maxDeadLetterScan = 10000
+
+// Headers describing the last failure, removed when a message is replayed so
+// that it starts over with a fresh attempt counter.
+var failureHeaders = []string{
+	HeaderReason, HeaderAttempts, HeaderLastStatus, HeaderError, HeaderWebhook,
+	HeaderQueue, HeaderFailedAt, HeaderViolations, HeaderDestination,
+}
+
+// DeadLetter is a message in the dead-letter queue of a webhook together with
+// the failure it was dead-lettered for. Messages rejected by RabbitMQ itself
+// carry no failure headers, only the body. Body has sensitive fields redacted
+// like the logs do; the message is replayed as it was received.
+type DeadLetter struct {
+	MessageID   string    `json:"message_id"`
+	Reason      string    `json:"reason"`
+	Destination string    `json:"destination,omitempty"`
+	Attempts    int       `json:"attempts"`
+	LastStatus  int       `json:"last_status"`
+	Error       string    `json:"error"`
+	FailedAt    time.Time `json:"failed_at,omitzero"`
+	Violations  []string  `json:"violations,omitempty"`
+	Body        any       `json:"body"`
+
+	delivery amqp.Delivery
+	doc      any
+}
+
+func (c *WebhookConsumer) newDeadLetter(d amqp.Delivery) DeadLetter {
+	dl := DeadLetter{
+		MessageID:   d.MessageId,
+		Reason:      fieldString(d.Headers[HeaderReason]),
+		Destination: fieldString(d.Headers[HeaderDestination]),
+		Attempts:    headerInt(d.Headers, HeaderAttempts),
+		LastStatus:  headerInt(d.Headers, HeaderLastStatus),
+		Error:       fieldString(d.Headers[HeaderError]),
+		Body:        c.fields.redact(d.Body),
+		delivery:    d,
+	}
+	if failedAt, err := time.Parse(time.RFC3339, fieldString(d.Headers[HeaderFailedAt])); err == nil {
+		dl.FailedAt = failedAt
+	}
+	if violations, ok := d.Headers[HeaderViolations].([]any); ok {
+		for _, violation := range violations {
+			dl.Violations = append(dl.Violations, fieldString(violation))
+		}
+	}
+	if doc, err := decodeDocument(d.Body); err == nil {
+		dl.doc = doc
+		dl.Body = json.RawMessage(c.fields.redact(d.Body))
+	}
+	return dl
+}
+
+// DeadLetterFilter selects dead-lettered messages. Empty fields match
+// everything. Field and Value match messages whose payload field equals Value,
+// ignoring case, like an "eq" route. At most Limit messages are selected, all
+// of them when Limit is 0.
+type DeadLetterFilter struct {
+	From        time.Time `json:"from"`
+	Until       time.Time `json:"until"`
+	Reason      string    `json:"reason"`
+	Destination string    `json:"destination"`
+	MessageID   string    `json:"message_id"`
+	Field       string    `json:"field"`
+	Value       string    `json:"value"`
+	Limit       int       `json:"limit"`
+}
+
+func (f DeadLetterFilter) matches(dl DeadLetter) bool {
+	if !f.From.IsZero() && dl.FailedAt.Before(f.From) {
+		return false
+	}
+	if !f.Until.IsZero() && !dl.FailedAt.Before(f.Until) {
+		return false
+	}
+	if f.Reason != "" && dl.Reason != f.Reason {
+		return false
+	}
+	if f.Destination != "" && dl.Destination != f.Destination {
+		return false
+	}
+	if f.MessageID != "" && dl.MessageID != f.MessageID {
+		return false
+	}
+	if f.Field != "" {
+		r := route{field: f.Field, op: pkg.RouteOpEq, values: []string{f.Value}}
+		if dl.doc == nil || !r.matches(dl.doc) {
+			return false
+		}
+	}
+	return true
+}
+
+// ReplayEdit changes messages before they are replayed. Set assigns a value to
+// a dotted path in every message, adding the field when it is missing. Body
+// replaces the whole message and is only allowed when a single message is
+// replayed.
+type ReplayEdit struct {
+	Set  map[string]any  `json:"set"`
+	Body json.RawMessage `json:"body"`
+}
+
+// DeadLetters lists the messages in the dead-letter queue of the webhook that
+// match filter. The queue is left as it was.
+func (c *WebhookConsumer) DeadLetters(ctx context.Context, filter DeadLetterFilter) ([]DeadLetter, error) {
+	ch, err := c.deadLetterChannel(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// Closing the channel puts every fetched message back into the queue
+	defer ch.Close()
+
+	return c.fetchDeadLetters(ch, filter)
+}
+
+// Replay moves the dead-lettered messages matching filter back into the queue
+// of the webhook, after applying edit. Replayed messages start over with a
+// fresh attempt counter and, if they were dead-lettered for one destination,
+// are only delivered to that destination again. It returns the replayed
+// messages as they were before the edit.
+func (c *WebhookConsumer) Replay(ctx context.Context, filter DeadLetterFilter, edit ReplayEdit) ([]DeadLetter, error) {
+	ch, err := c.deadLetterChannel(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// Messages that were fetched but not replayed go back into the queue
+	defer ch.Close()
+
+	matches, err := c.fetchDeadLetters(ch, filter)
+	if err != nil {
+		return nil, err
+	}
+	if len(edit.Body) > 0 && len(matches) != 1 {
+		return nil, fmt.Errorf("a replacement body needs exactly one matching message, %d match", len(matches))
+	}
+
+	for i, dl := range matches {
+		body, err := edit.apply(dl.delivery.Body)
+		if err != nil {
+			return matches[:i], fmt.Errorf("message %s: %w", dl.MessageID, err)
+		}
+
+		headers := copyHeaders(dl.delivery.Headers)
+		for _, header := range failureHeaders {
+			delete(headers, header)
+		}
+		headers[HeaderReplayedAt] = time.Now().UTC().Format(time.RFC3339)
+		msg := republishing(dl.delivery, headers)
+		msg.Body = body
+
+		if err := publishConfirmed(ch, "", c.hook.Queue, msg); err != nil {
+			return matches[:i], fmt.Errorf("failed to replay message %s: %w", dl.MessageID, err)
+		}
+		if err := dl.delivery.Ack(false); err != nil {
+			// The copy is already queued, the original is redelivered
+			// to the DLQ once the channel closes.
+			return matches[:i+1], fmt.Errorf("replayed message %s but failed to remove it from the DLQ: %w", dl.MessageID, err)
+		}
+		pkg.Log.Info(fmt.Sprintf("Replayed message %s from %s into %s",
+			dl.MessageID, pkg.DeadLetterQueue(c.hook.Queue), c.hook.Queue))
+	}
+	return matches, nil
+}
+
+func (c *WebhookConsumer) deadLetterChannel(ctx context.Context) (*amqp.Channel, error) {
+	gen, err := c.broker.Generation(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ch, err := gen.Conn.Channel()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open a channel: %w", err)
+	}
+	if err := ch.Confirm(false); err != nil {
+		ch.Close()
+		return nil, fmt.Errorf("failed to put channel into confirm mode: %w", err)
+	}
+	return ch, nil
+}
+
+// fetchDeadLetters reads the dead-letter queue without acking anything and
+// returns the messages matching filter, oldest first.
+func (c *WebhookConsumer) fetchDeadLetters(ch *amqp.Channel, filter DeadLetterFilter) ([]DeadLetter, error) {
+	queue := pkg.DeadLetterQueue(c.hook.Queue)
+	matches := []DeadLetter{}
+	for range maxDeadLetterScan {
+		d, ok, err := ch.Get(queue, false)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", queue, err)
+		}
+		if !ok {
+			break
+		}
+
+		dl := c.newDeadLetter(d)
+		if filter.matches(dl) {
+			matches = append(matches, dl)
+			if filter.Limit > 0 && len(matches) == filter.Limit {
+				break
+			}
+		}
+	}
+	return matches, nil
+}
+
+func (e ReplayEdit) apply(body []byte) ([]byte, error) {
+	if len(e.Body) > 0 {
+		body = e.Body
+	}
+	if len(e.Set) == 0 {
+		return body, nil
+	}
+
+	doc, err := decodeDocument(body)
+	if err != nil {
+		return nil, fmt.Errorf("cannot edit a message that is not JSON: %w", err)
+	}
+	for path, value := range e.Set {
+		if err := setField(doc, path, value); err != nil {
+			return nil, err
+		}
+	}
+	return json.Marshal(doc)
+}
+
+// setField sets path in doc to value, adding the last segment of the path to
+// objects that do not have it yet.
+func setField(doc any, path string, value any) error {
+	parent, key := "", path
+	if i := strings.LastIndex(path, "."); i >= 0 {
+		parent, key = path[:i], path[i+1:]
+	}
+
+	set := func(node any) error {
+		object, ok := node.(map[string]any)
+		if !ok {
+			return fmt.Errorf("cannot set %s: parent is not an object", path)
+		}
+		object[key] = value
+		return nil
+	}
+	if parent == "" {
+		return set(doc)
+	}
+
+	found := false
+	err := updateField(doc, parent, func(node any) (any, bool, error) {
+		found = true
+		return node, true, set(node)
+	})
+	if err == nil && !found {
+		err = fmt.Errorf("cannot set %s: %s does not exist", path, parent)
+	}
+	return err
+}
@@ -0,0 +1,113 @@
+package consumer
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"strconv"
+	"time"
+
+	"github.com/IAmRiteshKoushik/termite/pkg"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// retriesExhausted reports whether a message that has failed attempts times
+// should be given up on.
+func retriesExhausted(policy pkg.RetryPolicy, attempts int) bool {
+	return !policy.Unlimited && attempts >= policy.MaxAttempts
+}
+
+// retryTier picks the retry queue delay for the given (1-based) failed
+// attempt: the shortest tier that is neither shorter than the backoff nor than
+// notBefore, the wait the receiver asked for. Past the longest tier, which is
+// max_delay, that one is used. It returns false for policies without any retry queue, eg: with a
+// max_attempts of 1.
+func retryTier(policy pkg.RetryPolicy, attempt int, notBefore time.Duration) (time.Duration, bool) {
+	tiers := policy.Tiers()
+	if len(tiers) == 0 {
+		return 0, false
+	}
+	backoff := max(policy.Backoff(attempt), notBefore)
+	for _, tier := range tiers {
+		if tier >= backoff {
+			return tier, true
+		}
+	}
+	return tiers[len(tiers)-1], true
+}
+
+// retryDelay is the jittered wait before the next attempt. It never exceeds
+// tier so that it can be used as the per-message TTL inside the tier's retry
+// queue without holding up the messages queued behind it for long. Jitter
+// never makes it shorter than notBefore.
+func retryDelay(policy pkg.RetryPolicy, tier, notBefore time.Duration) time.Duration {
+	delay := tier
+	if policy.Jitter > 0 {
+		// Only ever shorten the delay so that MaxDelay stays an upper bound
+		delay -= time.Duration(rand.Float64() * policy.Jitter * float64(delay))
+	}
+	delay = min(max(delay, notBefore), tier)
+	return delay.Round(time.Millisecond)
+}
+
+// deliveryAttempts is the number of attempts already made for d, as carried in
+// its headers by earlier retries.
+func deliveryAttempts(d amqp.Delivery) int {
+	return headerInt(d.Headers, HeaderAttempts)
+}
+
+// nextRetry returns the retry queue delay and the jittered wait before the next
+// attempt of d, which failed for all of failures. It returns false when the
+// retry policy has no retry queue.
+func (c *WebhookConsumer) nextRetry(d amqp.Delivery, attempt int, failures []failure) (time.Duration, time.Duration, bool) {
+	// Honour the longest Retry-After, the message goes to all destinations
+	// of failures at once
+	var notBefore time.Duration
+	for _, f := range failures {
+		notBefore = max(notBefore, retryAfter(f.err))
+	}
+	tier, ok := retryTier(c.hook.Retry, attempt, notBefore)
+	if !ok {
+		return 0, 0, false
+	}
+	if notBefore > tier {
+		pkg.Log.Warn(fmt.Sprintf("Receiver asked to retry message %s after %s, retrying after the max_delay of %s instead",
+			d.MessageId, notBefore, tier))
+	}
+	return tier, retryDelay(c.hook.Retry, tier, notBefore), true
+}
+
+// scheduleRetry moves d into the retry queue matching its backoff and acks it,
+// so the consumer can move on to the next message right away. Once the delay
+// has passed RabbitMQ routes it back into the webhook's queue, pending only for
+// the destinations of failures.
+func (c *WebhookConsumer) scheduleRetry(ch *amqp.Channel, d amqp.Delivery, attempt int, failures []failure) {
+	tier, delay, ok := c.nextRetry(d, attempt, failures)
+	if !ok {
+		// Only reached when a dead-letter copy could not be published or
+		// the consumer is shutting down, both of which a requeue resolves
+		pkg.Log.Warn(fmt.Sprintf("%s has no retry queue, requeueing message %s", c.hook.Name, d.MessageId))
+		d.Nack(false, true)
+		return
+	}
+
+	headers := copyHeaders(d.Headers)
+	headers[HeaderAttempts] = attempt
+	headers[HeaderLastStatus] = lastStatus(failures[0].err)
+	headers[HeaderError] = failureMessage(failures)
+	headers[HeaderPending] = pendingHeader(failures)
+
+	msg := republishing(d, headers)
+	msg.Expiration = strconv.FormatInt(delay.Milliseconds(), 10)
+
+	retryQueue := pkg.RetryQueue(c.hook.Queue, tier)
+	if err := publishConfirmed(ch, "", retryQueue, msg); err != nil {
+		// Destinations that already accepted the message get it again
+		pkg.Log.Error(fmt.Sprintf("Failed to schedule retry for message %s, requeueing it", d.MessageId), err)
+		d.Nack(false, true)
+		return
+	}
+
+	pkg.Log.Info(fmt.Sprintf("Attempt %d for message %s failed for %d destinations, retrying in %s via %s",
+		attempt, d.MessageId, len(failures), delay, retryQueue))
+	d.Ack(false)
+}
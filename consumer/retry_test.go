@@ -0,0 +1,66 @@
+package consumer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/IAmRiteshKoushik/termite/pkg"
+)
+
+func TestRetryTier(t *testing.T) {
+	// Tiers: 5s 10s 5m
+	policy := pkg.RetryPolicy{MaxAttempts: 3, InitialDelay: 5 * time.Second, Multiplier: 2, MaxDelay: 5 * time.Minute}
+
+	tests := []struct {
+		name      string
+		attempt   int
+		notBefore time.Duration
+		want      time.Duration
+	}{
+		{"first attempt", 1, 0, 5 * time.Second},
+		{"second attempt", 2, 0, 10 * time.Second},
+		{"Retry-After within a tier", 1, 7 * time.Second, 10 * time.Second},
+		{"Retry-After longer than the backoff", 2, 2 * time.Minute, 5 * time.Minute},
+		{"Retry-After longer than max_delay", 1, time.Hour, 5 * time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := retryTier(policy, tt.attempt, tt.notBefore)
+			if !ok || got != tt.want {
+				t.Fatalf("retryTier(%d, %s) = %s, %t, want %s", tt.attempt, tt.notBefore, got, ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryTierWithoutRetries(t *testing.T) {
+	policy := pkg.RetryPolicy{MaxAttempts: 1, InitialDelay: 5 * time.Second, Multiplier: 2, MaxDelay: time.Minute}
+	if tier, ok := retryTier(policy, 1, 0); ok {
+		t.Fatalf("retryTier = %s, want no retry queue", tier)
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	policy := pkg.RetryPolicy{Jitter: 0.5}
+
+	tests := []struct {
+		name      string
+		tier      time.Duration
+		notBefore time.Duration
+		min, max  time.Duration
+	}{
+		{"jitter only shortens", 10 * time.Second, 0, 5 * time.Second, 10 * time.Second},
+		{"never below Retry-After", 10 * time.Second, 9 * time.Second, 9 * time.Second, 10 * time.Second},
+		{"never above the tier", 10 * time.Second, time.Minute, 10 * time.Second, 10 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for range 100 {
+				got := retryDelay(policy, tt.tier, tt.notBefore)
+				if got < tt.min || got > tt.max {
+					t.Fatalf("retryDelay(%s, %s) = %s, want between %s and %s", tt.tier, tt.notBefore, got, tt.min, tt.max)
+				}
+			}
+		})
+	}
+}
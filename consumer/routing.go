@@ -0,0 +1,139 @@
+package consumer
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/IAmRiteshKoushik/termite/pkg"
+)
+
+// route is a compiled `[[webhooks.routes]]` entry. String comparisons ignore
+// case, so "@Amrita.edu" and "@amrita.edu" route alike; matches is the
+// exception and uses the expression as written ("(?i)" makes it ignore case).
+type route struct {
+	field   string
+	op      string
+	values  []string
+	pattern *regexp.Regexp
+	dest    *destination
+}
+
+func newRoutes(configs []pkg.RouteConfig, dests []*destination) ([]route, error) {
+	routes := make([]route, 0, len(configs))
+	for i, cfg := range configs {
+		r := route{field: cfg.Field, op: cfg.Op}
+
+		if list, ok := cfg.Value.([]any); ok {
+			for _, value := range list {
+				r.values = append(r.values, fmt.Sprint(value))
+			}
+		} else if cfg.Value != nil {
+			r.values = []string{fmt.Sprint(cfg.Value)}
+		}
+
+		if r.op == pkg.RouteOpMatches {
+			pattern, err := regexp.Compile(r.values[0])
+			if err != nil {
+				return nil, fmt.Errorf("route #%d: %w", i+1, err)
+			}
+			r.pattern = pattern
+		}
+
+		for _, dest := range dests {
+			if dest.name == cfg.Destination {
+				r.dest = dest
+			}
+		}
+		if r.dest == nil {
+			return nil, fmt.Errorf("route #%d: unknown destination %q", i+1, cfg.Destination)
+		}
+		routes = append(routes, r)
+	}
+	return routes, nil
+}
+
+// String is used in log lines, eg: "problem_statements in [aiot] -> iot-lab".
+func (r route) String() string {
+	switch r.op {
+	case pkg.RouteOpExists:
+		return fmt.Sprintf("%s exists -> %s", r.field, r.dest.name)
+	case pkg.RouteOpIn, pkg.RouteOpNotIn:
+		return fmt.Sprintf("%s %s %v -> %s", r.field, r.op, r.values, r.dest.name)
+	}
+	return fmt.Sprintf("%s %s %q -> %s", r.field, r.op, r.values[0], r.dest.name)
+}
+
+// matches reports whether doc satisfies the route. Every value found at the
+// field counts, and so does every element of an array value: a team with
+// problem_statements ["aiot", "agentic_ai"] is "eq" to both tracks. ne and
+// not_in are the negations of eq and in, so they also match missing fields.
+func (r route) matches(doc any) bool {
+	var values []any
+	for _, value := range collectField(doc, r.field) {
+		if items, ok := value.([]any); ok {
+			values = append(values, items...)
+		} else if value != nil {
+			values = append(values, value)
+		}
+	}
+
+	switch r.op {
+	case pkg.RouteOpExists:
+		return len(values) > 0
+	case pkg.RouteOpNe, pkg.RouteOpNotIn:
+		return !slices.ContainsFunc(values, r.equals)
+	}
+	return slices.ContainsFunc(values, r.test)
+}
+
+// equals reports whether value equals any of the route's values.
+func (r route) equals(value any) bool {
+	s := fieldString(value)
+	return slices.ContainsFunc(r.values, func(v string) bool { return strings.EqualFold(s, v) })
+}
+
+func (r route) test(value any) bool {
+	s := strings.ToLower(fieldString(value))
+	switch r.op {
+	case pkg.RouteOpEq, pkg.RouteOpIn:
+		return r.equals(value)
+	case pkg.RouteOpContains:
+		return strings.Contains(s, strings.ToLower(r.values[0]))
+	case pkg.RouteOpPrefix:
+		return strings.HasPrefix(s, strings.ToLower(r.values[0]))
+	case pkg.RouteOpSuffix:
+		return strings.HasSuffix(s, strings.ToLower(r.values[0]))
+	case pkg.RouteOpMatches:
+		return r.pattern.MatchString(fieldString(value))
+	}
+	return false
+}
+
+// targets returns the destinations doc is routed to, in config order.
+// Destinations without a route get every message. Of the routed ones only the
+// destination of the first matching route gets it.
+func (c *WebhookConsumer) targets(doc any) []*destination {
+	if len(c.routes) == 0 {
+		return c.destinations
+	}
+
+	var matched *destination
+	for _, r := range c.routes {
+		if r.matches(doc) {
+			pkg.Log.Debug(fmt.Sprintf("Message for %s matched route %s", c.hook.Name, r))
+			matched = r.dest
+			break
+		}
+	}
+
+	var targets []*destination
+	for _, dest := range c.destinations {
+		routed := slices.ContainsFunc(c.routes, func(r route) bool { return r.dest == dest })
+		if !routed || dest == matched {
+			targets = append(targets, dest)
+		}
+	}
+	return targets
+}
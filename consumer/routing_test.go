@@ -0,0 +1,113 @@
+package consumer
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/IAmRiteshKoushik/termite/pkg"
+	"github.com/rs/zerolog"
+)
+
+func TestRouteMatches(t *testing.T) {
+	doc, err := decodeDocument([]byte(`{
+		"team_name": "Rocket",
+		"leader_email": "lead@CB.Amrita.edu",
+		"team_size": 4,
+		"problem_statements": ["aiot", "agentic_ai"],
+		"mentor": null
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dests := []*destination{{name: "portal"}}
+
+	tests := []struct {
+		name  string
+		route pkg.RouteConfig
+		want  bool
+	}{
+		{"eq ignores case", pkg.RouteConfig{Field: "team_name", Op: pkg.RouteOpEq, Value: "rocket"}, true},
+		{"eq number", pkg.RouteConfig{Field: "team_size", Op: pkg.RouteOpEq, Value: 4}, true},
+		{"eq array element", pkg.RouteConfig{Field: "problem_statements", Op: pkg.RouteOpEq, Value: "agentic_ai"}, true},
+		{"eq mismatch", pkg.RouteConfig{Field: "team_name", Op: pkg.RouteOpEq, Value: "Jet"}, false},
+		{"ne", pkg.RouteConfig{Field: "team_name", Op: pkg.RouteOpNe, Value: "Jet"}, true},
+		{"ne on any array element", pkg.RouteConfig{Field: "problem_statements", Op: pkg.RouteOpNe, Value: "aiot"}, false},
+		{"ne missing field", pkg.RouteConfig{Field: "college", Op: pkg.RouteOpNe, Value: "X"}, true},
+		{"in", pkg.RouteConfig{Field: "team_name", Op: pkg.RouteOpIn, Value: []any{"Jet", "Rocket"}}, true},
+		{"not_in", pkg.RouteConfig{Field: "problem_statements", Op: pkg.RouteOpNotIn, Value: []any{"web3", "fintech"}}, true},
+		{"contains", pkg.RouteConfig{Field: "leader_email", Op: pkg.RouteOpContains, Value: "amrita"}, true},
+		{"prefix", pkg.RouteConfig{Field: "team_name", Op: pkg.RouteOpPrefix, Value: "ro"}, true},
+		{"suffix ignores case", pkg.RouteConfig{Field: "leader_email", Op: pkg.RouteOpSuffix, Value: "@cb.amrita.edu"}, true},
+		{"matches is case sensitive", pkg.RouteConfig{Field: "leader_email", Op: pkg.RouteOpMatches, Value: `@cb\.amrita\.edu$`}, false},
+		{"matches with (?i)", pkg.RouteConfig{Field: "leader_email", Op: pkg.RouteOpMatches, Value: `(?i)@cb\.amrita\.edu$`}, true},
+		{"exists", pkg.RouteConfig{Field: "team_name", Op: pkg.RouteOpExists}, true},
+		{"exists null", pkg.RouteConfig{Field: "mentor", Op: pkg.RouteOpExists}, false},
+		{"exists missing", pkg.RouteConfig{Field: "college", Op: pkg.RouteOpExists}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.route.Destination = "portal"
+			routes, err := newRoutes([]pkg.RouteConfig{tt.route}, dests)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := routes[0].matches(doc); got != tt.want {
+				t.Fatalf("%s matches = %t, want %t", routes[0], got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTargets(t *testing.T) {
+	pkg.Log = &pkg.LoggerService{Logger: zerolog.Nop()}
+
+	iot, ai, sheets := &destination{name: "iot-lab"}, &destination{name: "ai-lab"}, &destination{name: "sheets"}
+	routes, err := newRoutes([]pkg.RouteConfig{
+		{Field: "problem_statement", Op: pkg.RouteOpEq, Value: "aiot", Destination: "iot-lab"},
+		{Field: "problem_statement", Op: pkg.RouteOpPrefix, Value: "a", Destination: "ai-lab"},
+	}, []*destination{iot, ai, sheets})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &WebhookConsumer{destinations: []*destination{iot, ai, sheets}, routes: routes}
+
+	tests := []struct {
+		name string
+		body string
+		want []*destination
+	}{
+		{"first matching route wins", `{"problem_statement": "aiot"}`, []*destination{iot, sheets}},
+		{"second route", `{"problem_statement": "agentic_ai"}`, []*destination{ai, sheets}},
+		{"no route matches", `{"problem_statement": "web3"}`, []*destination{sheets}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := decodeDocument([]byte(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := c.targets(doc); !slices.Equal(got, tt.want) {
+				t.Fatalf("targets = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewRoutesErrors(t *testing.T) {
+	dests := []*destination{{name: "portal"}}
+
+	tests := []struct {
+		name  string
+		route pkg.RouteConfig
+	}{
+		{"unknown destination", pkg.RouteConfig{Field: "team_name", Op: pkg.RouteOpEq, Value: "Rocket", Destination: "sheets"}},
+		{"invalid pattern", pkg.RouteConfig{Field: "team_name", Op: pkg.RouteOpMatches, Value: "(", Destination: "portal"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := newRoutes([]pkg.RouteConfig{tt.route}, dests); err == nil {
+				t.Fatal("newRoutes succeeded, want an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package consumer
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Outgoing requests of webhooks with signing secrets carry these headers, in
+// the same spirit as Stripe's: the signature covers "<timestamp>.<body>" so a
+// captured request cannot be replayed later with a fresh timestamp.
+//
+//	X-Termite-Timestamp: 1767225600
+//	X-Termite-Signature: t=1767225600,v1=5257a869...,v1=6ffbb59b...
+//
+// There is one v1 entry per configured secret. During a rotation both the new
+// and the old secret are configured and receivers accept the request as long
+// as any v1 entry matches a secret they know.
+const (
+	HeaderTimestamp = "X-Termite-Timestamp"
+	HeaderSignature = "X-Termite-Signature"
+)
+
+func signRequest(req *http.Request, body []byte, secrets []string, now time.Time) {
+	if len(secrets) == 0 {
+		return
+	}
+
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	parts := make([]string, 0, len(secrets)+1)
+	parts = append(parts, "t="+timestamp)
+	for _, secret := range secrets {
+		parts = append(parts, "v1="+computeSignature(secret, timestamp, body))
+	}
+
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderSignature, strings.Join(parts, ","))
+}
+
+func computeSignature(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,65 @@
+package consumer
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+
+	"github.com/IAmRiteshKoushik/termite/pkg"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+var ErrUnknownDestination = errors.New("unknown destination")
+
+// DeliveryResult is the outcome of a test delivery to one destination.
+type DeliveryResult struct {
+	Destination string `json:"destination"`
+	Delivered   bool   `json:"delivered"`
+	Status      int    `json:"status,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+// Config returns the configuration of the webhook.
+func (c *WebhookConsumer) Config() pkg.WebhookConfig {
+	return c.hook
+}
+
+// TestDelivery sends body through the same decoding, validation, routing and
+// rendering as a queued message and delivers it right away, bypassing
+// RabbitMQ. With destinationName set only that destination is tried, whether or
+// not the message is routed to it. Messages that would be dead-lettered fail
+// with the reason as error. Every test gets its own idempotency key, so
+// receivers can tell tests apart and nothing is deduplicated. Tests bypass the
+// circuit breakers, so they can be used to check on a destination whose
+// circuit is open.
+func (c *WebhookConsumer) TestDelivery(ctx context.Context, body []byte, destinationName string) ([]DeliveryResult, error) {
+	d := amqp.Delivery{Body: body, MessageId: "test-" + rand.Text()}
+
+	msg, err := c.prepare(d)
+	if err != nil {
+		return nil, err
+	}
+	msg.test = true
+
+	dests := msg.destinations
+	if destinationName != "" {
+		dest := c.destination(destinationName)
+		if dest == nil {
+			return nil, fmt.Errorf("%w %q", ErrUnknownDestination, destinationName)
+		}
+		dests = []*destination{dest}
+	}
+
+	pkg.Log.Info(fmt.Sprintf("Test delivery %s for %s to %d destinations", msg.key, c.hook.Name, len(dests)))
+	errs := c.deliver(ctx, dests, msg)
+	results := make([]DeliveryResult, len(dests))
+	for i, dest := range dests {
+		results[i] = DeliveryResult{Destination: dest.name, Delivered: errs[i] == nil}
+		if errs[i] != nil {
+			results[i].Status = lastStatus(errs[i])
+			results[i].Error = errs[i].Error()
+		}
+	}
+	return results, nil
+}
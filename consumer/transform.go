@@ -0,0 +1,143 @@
+package consumer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/IAmRiteshKoushik/termite/pkg"
+)
+
+const defaultContentType = "application/json"
+
+// outgoing is a rendered request, ready to be signed and sent.
+type outgoing struct {
+	body           []byte
+	contentType    string
+	headers        http.Header
+	description    string
+	idempotencyKey string
+	attempt        int
+}
+
+// transform maps a message onto the body and headers a receiver expects. The
+// templates are Go text/templates executed against the message as decoded
+// JSON, after field policies were applied, so `{{ .team_name }}` is the team
+// name and a dropped field is simply missing.
+type transform struct {
+	body        *template.Template // nil sends the message as-is
+	headers     map[string]*template.Template
+	contentType string
+}
+
+var templateFuncs = template.FuncMap{
+	// json encodes a value, use it for every value placed into a JSON body
+	// so that strings are quoted and escaped: {"name": {{ json .name }}}
+	"json": func(v any) (string, error) {
+		encoded, err := json.Marshal(v)
+		return string(encoded), err
+	},
+	"lower": func(v any) string { return strings.ToLower(fieldString(v)) },
+	"upper": func(v any) string { return strings.ToUpper(fieldString(v)) },
+	"trim":  func(v any) string { return strings.TrimSpace(fieldString(v)) },
+	"join": func(sep string, v any) string {
+		items, _ := v.([]any)
+		parts := make([]string, len(items))
+		for i, item := range items {
+			parts[i] = fieldString(item)
+		}
+		return strings.Join(parts, sep)
+	},
+	"default": func(fallback, v any) any {
+		if v == nil || fieldString(v) == "" {
+			return fallback
+		}
+		return v
+	},
+	"now": func() string { return time.Now().UTC().Format(time.RFC3339) },
+}
+
+func newTransform(cfg pkg.TransformConfig) (*transform, error) {
+	t := &transform{
+		headers:     map[string]*template.Template{},
+		contentType: cfg.ContentType,
+	}
+	if t.contentType == "" {
+		t.contentType = defaultContentType
+	}
+
+	source := cfg.Body
+	if cfg.BodyFile != "" {
+		data, err := os.ReadFile(cfg.BodyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read body template: %w", err)
+		}
+		source = string(data)
+	}
+	if source != "" {
+		body, err := parseTemplate("body", source)
+		if err != nil {
+			return nil, err
+		}
+		t.body = body
+	}
+
+	for name, source := range cfg.Headers {
+		header, err := parseTemplate(name, source)
+		if err != nil {
+			return nil, err
+		}
+		t.headers[http.CanonicalHeaderKey(name)] = header
+	}
+	return t, nil
+}
+
+func parseTemplate(name, source string) (*template.Template, error) {
+	tmpl, err := template.New(name).Funcs(templateFuncs).Option("missingkey=zero").Parse(source)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s template: %w", name, err)
+	}
+	return tmpl, nil
+}
+
+// apply renders body into the outgoing request.
+func (t *transform) apply(body []byte) (*outgoing, error) {
+	out := &outgoing{
+		body:        body,
+		contentType: t.contentType,
+		headers:     http.Header{},
+	}
+	if t.body == nil && len(t.headers) == 0 {
+		return out, nil
+	}
+
+	doc, err := decodeDocument(body)
+	if err != nil {
+		return nil, err
+	}
+
+	if t.body != nil {
+		var rendered bytes.Buffer
+		if err := t.body.Execute(&rendered, doc); err != nil {
+			return nil, fmt.Errorf("failed to render body: %w", err)
+		}
+		out.body = rendered.Bytes()
+		if t.contentType == defaultContentType && !json.Valid(out.body) {
+			return nil, fmt.Errorf("rendered body is not valid JSON")
+		}
+	}
+
+	for name, tmpl := range t.headers {
+		var rendered strings.Builder
+		if err := tmpl.Execute(&rendered, doc); err != nil {
+			return nil, fmt.Errorf("failed to render header %s: %w", name, err)
+		}
+		out.headers.Set(name, strings.TrimSpace(rendered.String()))
+	}
+	return out, nil
+}
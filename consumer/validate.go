@@ -0,0 +1,246 @@
+package consumer
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/mail"
+	"net/url"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+var phonePattern = regexp.MustCompile(`^\+?[0-9 ()\-]+$`)
+
+// validationRule checks a single rule against every value found at path.
+// Rules are written like `validate` struct tags: comma separated, with
+// arguments after "=" and space separated alternatives for oneof.
+//
+//	required            present, not null and not empty
+//	email               a bare email address
+//	phone               7 to 15 digits, optionally with +, spaces, dashes, ()
+//	url                 an absolute URL
+//	min=N, max=N        length of strings/arrays, value of numbers
+//	oneof=a b c         value (or every element of an array) is one of these
+type validationRule struct {
+	path string
+	name string
+	arg  string
+}
+
+func (r validationRule) String() string {
+	if r.arg == "" {
+		return r.path + ": " + r.name
+	}
+	return r.path + ": " + r.name + "=" + r.arg
+}
+
+// parseRules turns a rule string into rules for path.
+func parseRules(path, spec string) ([]validationRule, error) {
+	var rules []validationRule
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, arg, _ := strings.Cut(part, "=")
+		rule := validationRule{path: path, name: name, arg: arg}
+
+		switch name {
+		case "required", "email", "phone", "url":
+		case "min", "max":
+			if _, err := strconv.ParseFloat(arg, 64); err != nil {
+				return nil, fmt.Errorf("rule %s needs a number", rule)
+			}
+		case "oneof":
+			if strings.TrimSpace(arg) == "" {
+				return nil, fmt.Errorf("rule %s needs at least one value", rule)
+			}
+		default:
+			return nil, fmt.Errorf("unknown rule %q", name)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// tagRules collects the `validate` struct tags of a payload type. Paths are
+// built from the json tags and slices of structs become "*" segments.
+func tagRules(t reflect.Type, prefix string) []validationRule {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+
+	var rules []validationRule
+	for i := range t.NumField() {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		path := prefix + name
+
+		if spec := field.Tag.Get("validate"); spec != "" {
+			parsed, err := parseRules(path, spec)
+			if err != nil {
+				// Tags are part of the source, a typo is a programming error
+				panic(fmt.Sprintf("invalid validate tag on %s.%s: %v", t.Name(), field.Name, err))
+			}
+			rules = append(rules, parsed...)
+		}
+
+		elem := field.Type
+		if elem.Kind() == reflect.Slice {
+			rules = append(rules, tagRules(elem.Elem(), path+".*.")...)
+		} else {
+			rules = append(rules, tagRules(elem, path+".")...)
+		}
+	}
+	return rules
+}
+
+// validateDocument checks doc against rules and returns every violated rule.
+func validateDocument(doc any, rules []validationRule) []string {
+	var violations []string
+	for _, rule := range rules {
+		if rule.name == "required" {
+			if !checkRequired(doc, rule) {
+				violations = append(violations, rule.String())
+			}
+			continue
+		}
+
+		// Other rules only apply to fields that are present
+		for _, value := range collectField(doc, rule.path) {
+			if !checkRule(rule, value) {
+				violations = append(violations, rule.String())
+				break
+			}
+		}
+	}
+	return violations
+}
+
+// checkRequired looks the last segment of the path up in every parent, so that
+// "team_members.*.email" catches a single member without an email.
+func checkRequired(doc any, rule validationRule) bool {
+	parents := []any{doc}
+	key := rule.path
+	if i := strings.LastIndex(rule.path, "."); i >= 0 {
+		key = rule.path[i+1:]
+		parents = collectField(doc, rule.path[:i])
+		if len(parents) == 0 && !strings.Contains(rule.path[:i], "*") {
+			return false
+		}
+	}
+
+	for _, parent := range parents {
+		values := collectField(parent, key)
+		if len(values) == 0 {
+			return false
+		}
+		for _, value := range values {
+			if !checkRule(rule, value) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// collectField returns every value at path, expanding "*" segments.
+func collectField(doc any, path string) []any {
+	var values []any
+	_ = updateField(doc, path, func(value any) (any, bool, error) {
+		values = append(values, value)
+		return value, true, nil
+	})
+	return values
+}
+
+func checkRule(rule validationRule, value any) bool {
+	switch rule.name {
+	case "required":
+		switch v := value.(type) {
+		case nil:
+			return false
+		case string:
+			return strings.TrimSpace(v) != ""
+		case []any:
+			return len(v) > 0
+		case map[string]any:
+			return len(v) > 0
+		}
+		return true
+	case "email":
+		s, ok := value.(string)
+		if !ok {
+			return false
+		}
+		addr, err := mail.ParseAddress(s)
+		return err == nil && addr.Name == "" && addr.Address == s
+	case "phone":
+		s, ok := value.(string)
+		if !ok || !phonePattern.MatchString(s) {
+			return false
+		}
+		digits := 0
+		for _, r := range s {
+			if r >= '0' && r <= '9' {
+				digits++
+			}
+		}
+		return digits >= 7 && digits <= 15
+	case "url":
+		s, ok := value.(string)
+		if !ok {
+			return false
+		}
+		u, err := url.ParseRequestURI(s)
+		return err == nil && u.Scheme != "" && u.Host != ""
+	case "min", "max":
+		limit, _ := strconv.ParseFloat(rule.arg, 64)
+		size, ok := measure(value)
+		if !ok {
+			return false
+		}
+		if rule.name == "min" {
+			return size >= limit
+		}
+		return size <= limit
+	case "oneof":
+		allowed := strings.Fields(rule.arg)
+		if items, ok := value.([]any); ok {
+			for _, item := range items {
+				if !slices.Contains(allowed, fieldString(item)) {
+					return false
+				}
+			}
+			return true
+		}
+		return slices.Contains(allowed, fieldString(value))
+	}
+	return true
+}
+
+// measure is the quantity min and max compare against.
+func measure(value any) (float64, bool) {
+	switch v := value.(type) {
+	case string:
+		return float64(utf8.RuneCountInString(v)), true
+	case []any:
+		return float64(len(v)), true
+	case map[string]any:
+		return float64(len(v)), true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
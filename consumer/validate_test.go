@@ -0,0 +1,66 @@
+package consumer
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestValidateDocument(t *testing.T) {
+	tests := []struct {
+		name  string
+		path  string
+		rules string
+		body  string
+		want  []string
+	}{
+		{"required present", "team_name", "required", `{"team_name": "Rocket"}`, nil},
+		{"required missing", "team_name", "required", `{}`, []string{"team_name: required"}},
+		{"required blank", "team_name", "required", `{"team_name": "  "}`, []string{"team_name: required"}},
+		{"required null", "team_name", "required", `{"team_name": null}`, []string{"team_name: required"}},
+		{"required in every element", "members.*.email", "required",
+			`{"members": [{"email": "a@b.co"}, {"name": "m"}]}`, []string{"members.*.email: required"}},
+		{"required without elements", "members.*.email", "required", `{"members": []}`, nil},
+		{"email", "email", "email", `{"email": "a@b.co"}`, nil},
+		{"email with a name", "email", "email", `{"email": "A <a@b.co>"}`, []string{"email: email"}},
+		{"email missing is not checked", "email", "email", `{}`, nil},
+		{"phone", "phone", "phone", `{"phone": "+91 (999) 999-9999"}`, nil},
+		{"phone too short", "phone", "phone", `{"phone": "12345"}`, []string{"phone: phone"}},
+		{"phone with letters", "phone", "phone", `{"phone": "+91 99999 ABCDE"}`, []string{"phone: phone"}},
+		{"url", "site", "url", `{"site": "https://example.com/x"}`, nil},
+		{"url relative", "site", "url", `{"site": "/x"}`, []string{"site: url"}},
+		{"min string", "name", "min=3", `{"name": "ab"}`, []string{"name: min=3"}},
+		{"min counts runes", "name", "min=3", `{"name": "äöü"}`, nil},
+		{"max array", "tags", "max=2", `{"tags": ["a", "b", "c"]}`, []string{"tags: max=2"}},
+		{"max number", "size", "max=4", `{"size": 4}`, nil},
+		{"min number", "size", "min=2", `{"size": 1.5}`, []string{"size: min=2"}},
+		{"oneof", "track", "oneof=aiot agentic_ai", `{"track": "aiot"}`, nil},
+		{"oneof mismatch", "track", "oneof=aiot agentic_ai", `{"track": "web3"}`, []string{"track: oneof=aiot agentic_ai"}},
+		{"oneof array", "tracks", "oneof=aiot agentic_ai", `{"tracks": ["aiot", "web3"]}`, []string{"tracks: oneof=aiot agentic_ai"}},
+		{"several rules", "email", "required,email,max=5", `{"email": "a@b.co"}`, []string{"email: max=5"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules, err := parseRules(tt.path, tt.rules)
+			if err != nil {
+				t.Fatal(err)
+			}
+			doc, err := decodeDocument([]byte(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := validateDocument(doc, rules); !slices.Equal(got, tt.want) {
+				t.Fatalf("violations = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRulesErrors(t *testing.T) {
+	for _, spec := range []string{"unknown", "min", "max=ten", "oneof=", "required,oneof= "} {
+		t.Run(spec, func(t *testing.T) {
+			if _, err := parseRules("field", spec); err == nil {
+				t.Fatalf("parseRules(%q) succeeded, want an error", spec)
+			}
+		})
+	}
+}
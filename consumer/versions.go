@@ -0,0 +1,51 @@
+package consumer
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Producers state the schema version of a message in the HeaderSchemaVersion
+// header or, if they cannot set headers, in a top level VersionField of the
+// JSON body. The header wins when both are present. Messages without either
+// are assumed to be of the webhook's `schema_version` (1 unless configured).
+const (
+	HeaderSchemaVersion = "x-schema-version"
+	VersionField        = "schema_version"
+)
+
+var ErrUnknownVersion = errors.New("unknown schema version")
+
+// messageVersion reads the schema version of d.
+func messageVersion(d amqp.Delivery, fallback int) (int, error) {
+	if value, ok := d.Headers[HeaderSchemaVersion]; ok {
+		return parseVersion(value)
+	}
+
+	if doc, err := decodeDocument(d.Body); err == nil {
+		if value, ok := lookupField(doc, VersionField); ok {
+			return parseVersion(value)
+		}
+	}
+	return fallback, nil
+}
+
+// parseVersion accepts integers, numeric strings and "v2" style strings.
+func parseVersion(value any) (int, error) {
+	if version, ok := toInt(value); ok {
+		return version, nil
+	}
+
+	s := fieldString(value)
+	if len(s) > 1 && (s[0] == 'v' || s[0] == 'V') {
+		s = s[1:]
+	}
+	version, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %q", ErrUnknownVersion, fieldString(value))
+	}
+	return version, nil
+}
@@ -0,0 +1,16 @@
+package consumer
+
+type WoCPayload struct {
+	FirstName string `json:"firstName" validate:"required,max=100"`
+	LastName  string `json:"lastName" validate:"max=100"`
+	Email     string `json:"email" validate:"required,email"`
+	Password  string `json:"password" validate:"required"`
+}
+
+func init() {
+	registerSchema("woc", func() Payload { return &WoCPayload{} })
+}
+
+func (p *WoCPayload) Describe() string {
+	return "email: " + p.Email
+}
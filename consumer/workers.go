@@ -0,0 +1,101 @@
+package consumer
+
+import (
+	"context"
+	"hash/fnv"
+	"sync"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// workerPool hands deliveries to the workers of a webhook. Without a partition
+// key any idle worker picks up the next delivery. With one, deliveries are
+// hashed on the value of that field so that messages sharing a key are handled
+// one after the other by the same worker, while different keys still run in
+// parallel.
+type workerPool struct {
+	queues       []chan amqp.Delivery
+	partitionKey string
+	wg           sync.WaitGroup
+}
+
+// startWorkers starts the workers of c on ch. Workers settle their own
+// deliveries. Completion order differs from delivery order, so every ack and
+// nack covers exactly one delivery tag; a multiple-ack would also settle
+// messages other workers still hold.
+func (c *WebhookConsumer) startWorkers(ctx context.Context, ch *amqp.Channel) *workerPool {
+	pool := &workerPool{partitionKey: c.hook.PartitionKey}
+
+	if pool.partitionKey == "" {
+		shared := make(chan amqp.Delivery)
+		for range c.hook.Workers {
+			pool.queues = append(pool.queues, shared)
+		}
+	} else {
+		// Prefetch bounds the number of unacked deliveries, so a buffer of
+		// that size means a worker stuck on a slow key never blocks the
+		// deliveries meant for the other workers.
+		for range c.hook.Workers {
+			pool.queues = append(pool.queues, make(chan amqp.Delivery, c.hook.Prefetch))
+		}
+	}
+
+	for _, queue := range pool.queues {
+		pool.wg.Add(1)
+		go func() {
+			defer pool.wg.Done()
+			for d := range queue {
+				// Deliveries still queued at shutdown go back to RabbitMQ
+				if ctx.Err() != nil {
+					d.Nack(false, true)
+					continue
+				}
+				c.handle(ctx, ch, d)
+			}
+		}()
+	}
+	return pool
+}
+
+// submit hands d to a worker. It returns false if ctx was cancelled while all
+// workers were busy, in which case the caller still owns d.
+func (p *workerPool) submit(ctx context.Context, d amqp.Delivery) bool {
+	select {
+	case p.queues[p.worker(d)] <- d:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (p *workerPool) worker(d amqp.Delivery) int {
+	if p.partitionKey == "" {
+		return 0 // All workers share one queue
+	}
+
+	// Messages without the field (or that are not JSON at all) share a key
+	// and are serialized among themselves.
+	var key string
+	if doc, err := decodeDocument(d.Body); err == nil {
+		if value, ok := lookupField(doc, p.partitionKey); ok {
+			key = fieldString(value)
+		}
+	}
+
+	hash := fnv.New32a()
+	hash.Write([]byte(key))
+	return int(hash.Sum32() % uint32(len(p.queues)))
+}
+
+// stop waits for the workers to finish what they were handed. In-flight
+// deliveries are completed, queued ones are requeued once ctx is cancelled.
+func (p *workerPool) stop() {
+	closed := make(map[chan amqp.Delivery]bool, len(p.queues))
+	for _, queue := range p.queues {
+		if !closed[queue] {
+			close(queue)
+			closed[queue] = true
+		}
+	}
+	p.wg.Wait()
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net/http/httputil"
+	"os"
+	"strings"
+
+	"github.com/IAmRiteshKoushik/termite/consumer"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// dryRun prints the requests a webhook would send for a sample message, one
+// per destination, eg:
+//
+//	termite dry-run -webhook aiverse -file scripts/sample.json
+//	termite dry-run -webhook aiverse -header x-schema-version=1 < sample.json
+//
+// Nothing is read from or published to RabbitMQ and nothing is sent to the
+// destinations, but OAuth2 destinations do fetch a token from their token
+// endpoint. It returns the process exit code.
+func dryRun(args []string) int {
+	flags := flag.NewFlagSet("dry-run", flag.ContinueOnError)
+	name := flags.String("webhook", "", "name of the [[webhooks]] entry to render for")
+	file := flags.String("file", "-", "sample message, - reads from stdin")
+	headers := amqp.Table{}
+	flags.Func("header", "AMQP header of the sample message as key=value, can be repeated", func(s string) error {
+		key, value, ok := strings.Cut(s, "=")
+		if !ok {
+			return fmt.Errorf("expected key=value")
+		}
+		headers[key] = value
+		return nil
+	})
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	hook, ok := findWebhook(*name)
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown webhook %q\n", *name)
+		return 2
+	}
+
+	var body []byte
+	var err error
+	if *file == "-" {
+		body, err = io.ReadAll(os.Stdin)
+	} else {
+		body, err = os.ReadFile(*file)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to read sample message: %v\n", err)
+		return 1
+	}
+
+	c, err := consumer.NewWebhookConsumer(hook, nil, nil)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	requests, err := c.DryRun(body, headers)
+	if err != nil {
+		if reason, ok := consumer.DeadLetterReason(err); ok {
+			fmt.Fprintf(os.Stderr, "message would be dead-lettered (%s): %v\n", reason, err)
+		} else {
+			fmt.Fprintf(os.Stderr, "failed to build request, the message would be retried: %v\n", err)
+		}
+		return 1
+	}
+	if len(requests) == 0 {
+		fmt.Fprintln(os.Stderr, "message matches no destination and would be acknowledged")
+		return 0
+	}
+
+	for _, req := range requests {
+		dump, err := httputil.DumpRequestOut(req, true)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to print request: %v\n", err)
+			return 1
+		}
+		os.Stdout.Write(dump)
+		fmt.Println()
+		fmt.Println()
+	}
+	return 0
+}
@@ -9,6 +9,7 @@ import (
 	"sync"
 	"syscall"
 
+	"github.com/IAmRiteshKoushik/termite/api"
 	"github.com/IAmRiteshKoushik/termite/consumer"
 	"github.com/IAmRiteshKoushik/termite/pkg"
 )
@@ -28,8 +29,21 @@ func main() {
 	}
 	pkg.Log.Info("[OK]: Logger initialized successfully")
 
+	// Subcommands share the configuration. dry-run never touches the broker,
+	// replay opens its own connection to read the dead-letter queues.
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "dry-run":
+			os.Exit(dryRun(os.Args[2:]))
+		case "replay":
+			os.Exit(replay(os.Args[2:]))
+		default:
+			log.Fatalf("Unknown command %q", os.Args[1])
+		}
+	}
+
 	// Initialize message broker
-	pkg.Rabbit, err = pkg.NewBroker(pkg.AppConfig.RabbitMQURL)
+	pkg.Rabbit, err = pkg.NewBroker(pkg.AppConfig.RabbitMQURL, pkg.AppConfig.Topology())
 	if err != nil {
 		pkg.Log.Fatal("[BAD]: Failed to initialize message broker", err)
 	}
@@ -42,6 +56,18 @@ func main() {
 	}()
 	pkg.Log.Info("[OK]: Message broker initialized successfully")
 
+	// Local store of deliveries, so redelivered messages are not posted twice
+	pkg.DB, err = pkg.OpenStore(pkg.AppConfig.Store.Path)
+	if err != nil {
+		pkg.Log.Fatal("[BAD]: Failed to open store", err)
+	}
+	defer func() {
+		if err := pkg.DB.Close(); err != nil {
+			pkg.Log.Error("[BAD]: Failed to close store", err)
+		}
+	}()
+	pkg.Log.Info("[OK]: Store opened successfully")
+
 	// Create a raw context and pass into the consumer routines. This allows us
 	// to propagate background state like cancellation SIGNALS into the consumer
 	// goroutines
@@ -63,25 +89,44 @@ func main() {
 	// work getting hampered in between
 	var wg sync.WaitGroup
 
-	wocConsumer := consumer.NewWocConsumer(pkg.Rabbit.Conn())
-	aiConsumer := consumer.NewAiConsumer(pkg.Rabbit.Conn())
+	// Every [[webhooks]] entry in env.toml gets its own consumer. A bad entry
+	// (eg: unknown schema) is fatal so that misconfiguration is caught at boot
+	// instead of silently leaving a queue unattended.
+	consumers := make([]*consumer.WebhookConsumer, 0, len(pkg.AppConfig.Webhooks))
+	for _, hook := range pkg.AppConfig.Webhooks {
+		c, err := consumer.NewWebhookConsumer(hook, pkg.Rabbit, pkg.DB)
+		if err != nil {
+			pkg.Log.Fatal("[BAD]: Failed to create webhook consumer", err)
+		}
+		consumers = append(consumers, c)
+	}
 
 	wg.Add(1)
 	go func() {
-		defer wg.Done() // Is executed when the consumer stops / errors out.
-		if err := wocConsumer.Listen(ctx); err != nil {
-			pkg.Log.Error("WOC consumer stopped with an error", err)
-		}
+		defer wg.Done()
+		pkg.DB.Prune(ctx, pkg.AppConfig.Store)
 	}()
 
+	// Admin API, stopped together with the consumers
+	server := api.NewServer(pkg.AppConfig.API, consumers, pkg.Rabbit, pkg.DB)
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		if err := aiConsumer.Listen(ctx); err != nil {
-			pkg.Log.Error("AI consumer stopped with an error", err)
+		if err := server.Run(ctx); err != nil {
+			pkg.Log.Error("[BAD]: Admin API stopped with an error", err)
 		}
 	}()
 
+	for _, c := range consumers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done() // Is executed when the consumer stops / errors out.
+			if err := c.Listen(ctx); err != nil {
+				pkg.Log.Error(fmt.Sprintf("%s consumer stopped with an error", c.Name()), err)
+			}
+		}()
+	}
+
 	pkg.Log.Info("Consumers are up and running. Press CTRL+C to exit.")
 	// This is where the main goroutine halts. If it gets either SIGTERM or SIGINT
 	// then that signal is received here. The use of the variable to capture the
@@ -98,3 +143,13 @@ func main() {
 
 	pkg.Log.Info("All consumers have shut down. Exiting.")
 }
+
+// findWebhook returns the `[[webhooks]]` entry with the given name.
+func findWebhook(name string) (pkg.WebhookConfig, bool) {
+	for _, hook := range pkg.AppConfig.Webhooks {
+		if hook.Name == name {
+			return hook, true
+		}
+	}
+	return pkg.WebhookConfig{}, false
+}
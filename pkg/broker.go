@@ -1,33 +1,87 @@
 package pkg
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"sync"
 	"time"
 
 	amqp "github.com/rabbitmq/amqp091-go"
 )
 
 const (
-	QueueHackathonRegistrations = "ai-hackathon-registrations"
-	QueueWocRegistrations       = "woc-registrations"
+	reconnectMinDelay = 1 * time.Second
+	reconnectMaxDelay = 30 * time.Second
 )
 
-var allQueues = []string{
-	QueueWocRegistrations,
-	QueueHackathonRegistrations,
+// Every consumer queue dead-letters into this exchange, routed by the name of
+// the queue the message came from, into a companion DeadLetterQueue.
+const DeadLetterExchange = "termite.dlx"
+
+var ErrBrokerClosed = errors.New("message broker is closed")
+
+// DeadLetterQueue is the companion queue holding failed messages of queue.
+func DeadLetterQueue(queue string) string {
+	return queue + ".dlq"
+}
+
+// RetryQueue holds messages of queue that wait delay before their next
+// attempt. It has no consumers: messages expire after delay and are
+// dead-lettered back into queue through the default exchange.
+func RetryQueue(queue string, delay time.Duration) string {
+	return fmt.Sprintf("%s.retry.%s", queue, delay)
+}
+
+// QueueTopology describes a consumer queue together with the delays of the
+// retry queues that feed back into it.
+type QueueTopology struct {
+	Queue       string
+	RetryDelays []time.Duration
 }
 
 var Rabbit *MsgBroker
 
 type MsgBroker struct {
+	mu      sync.Mutex
 	conn    *amqp.Connection
 	connURL string
 	channel *amqp.Channel
+	queues  []QueueTopology
+
+	// Every successful (re)connect starts a new generation. ready is closed
+	// once gen holds a live connection and is replaced as soon as that
+	// connection is lost, so waiters block until the next one comes up.
+	gen     *Generation
+	genID   uint64
+	ready   chan struct{}
+	done    chan struct{}
+	closing bool
 }
 
-func NewBroker(connStr string) (*MsgBroker, error) {
+// Generation is one live connection to RabbitMQ. Consumers open their
+// channels on Conn and go back to MsgBroker.Generation once Lost is closed.
+type Generation struct {
+	ID   uint64
+	Conn *amqp.Connection
+	lost chan struct{}
+}
+
+// Lost is closed when the connection of this generation goes away.
+func (g *Generation) Lost() <-chan struct{} {
+	return g.lost
+}
+
+// NewBroker connects to RabbitMQ and declares every queue in queues along with
+// its dead-letter and retry queues, so that consumers can start consuming
+// straight away. The connection is supervised
+// from then on and re-established with backoff whenever it drops.
+func NewBroker(connStr string, queues []QueueTopology) (*MsgBroker, error) {
 	client := &MsgBroker{
 		connURL: connStr,
+		queues:  queues,
+		ready:   make(chan struct{}),
+		done:    make(chan struct{}),
 	}
 
 	if err := client.connect(); err != nil {
@@ -35,88 +89,239 @@ func NewBroker(connStr string) (*MsgBroker, error) {
 		return nil, err
 	}
 
+	if err := client.declareQueues(); err != nil {
+		Log.Error("[BAD]: Message broker failed to declare queues", err)
+		_ = client.Close()
+		return nil, err
+	}
+
+	go client.handleReconnect(client.startGeneration())
 	return client, nil
 }
 
 func (r *MsgBroker) connect() error {
-	var err error
-	r.conn, err = amqp.Dial(r.connURL)
+	conn, err := amqp.Dial(r.connURL)
 	if err != nil {
 		return err
 	}
 
-	r.channel, err = r.conn.Channel()
+	channel, err := conn.Channel()
 	if err != nil {
-		_ = r.conn.Close()
+		_ = conn.Close()
 		return err
 	}
+
+	r.mu.Lock()
+	r.conn = conn
+	r.channel = channel
+	r.mu.Unlock()
 	return nil
 }
 
 func (r *MsgBroker) declareQueues() error {
-	for _, queueName := range allQueues {
-		_, err := r.channel.QueueDeclare(
-			queueName,
-			true,  // durable
-			false, // delete when unused
-			false, // exclusive
-			false, // no-wait
-			nil,   // args
-		)
+	err := r.channel.ExchangeDeclare(
+		DeadLetterExchange,
+		amqp.ExchangeDirect,
+		true,  // durable
+		false, // auto-deleted
+		false, // internal
+		false, // no-wait
+		nil,   // args
+	)
+	if err != nil {
+		return fmt.Errorf("failed to declare exchange %s: %w", DeadLetterExchange, err)
+	}
+
+	for _, topology := range r.queues {
+		queueName := topology.Queue
+		dlq := DeadLetterQueue(queueName)
+		if err := r.declareQueue(dlq, nil); err != nil {
+			return err
+		}
+		if err := r.channel.QueueBind(dlq, queueName, DeadLetterExchange, false, nil); err != nil {
+			return fmt.Errorf("failed to bind queue %s: %w", dlq, err)
+		}
+
+		// Anything rejected without requeue (or expired) ends up in the DLQ
+		// even if the consumer could not publish it there itself.
+		err := r.declareQueue(queueName, amqp.Table{
+			"x-dead-letter-exchange":    DeadLetterExchange,
+			"x-dead-letter-routing-key": queueName,
+		})
 		if err != nil {
-			return fmt.Errorf("failed to declare queue %s: %w", queueName, err)
+			return err
+		}
+		Log.Info(fmt.Sprintf("Successfully declared queue: %s (dead-letters to %s)", queueName, dlq))
+
+		for _, delay := range topology.RetryDelays {
+			err := r.declareQueue(RetryQueue(queueName, delay), amqp.Table{
+				"x-message-ttl":             delay.Milliseconds(),
+				"x-dead-letter-exchange":    "",
+				"x-dead-letter-routing-key": queueName,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		if len(topology.RetryDelays) > 0 {
+			Log.Info(fmt.Sprintf("Successfully declared %d retry queues for %s", len(topology.RetryDelays), queueName))
 		}
-		Log.Info(fmt.Sprintf("Successfully delcared queue: %s", queueName))
 	}
 
 	Log.Info("All queues declared successfully.")
 	return nil
 }
 
-func (r *MsgBroker) handleReconnect() {
-	errChan := make(chan *amqp.Error)
-	r.conn.NotifyClose(errChan)
+func (r *MsgBroker) declareQueue(name string, args amqp.Table) error {
+	_, err := r.channel.QueueDeclare(
+		name,
+		true,  // durable
+		false, // delete when unused
+		false, // exclusive
+		false, // no-wait
+		args,  // args
+	)
+	if err != nil {
+		return fmt.Errorf("failed to declare queue %s: %w", name, err)
+	}
+	return nil
+}
 
-	for err := range errChan {
-		Log.Error("Broker connection lost. Attempting to reconnect...", err)
+// startGeneration publishes the current connection to everyone waiting in
+// Generation.
+func (r *MsgBroker) startGeneration() *Generation {
+	r.mu.Lock()
+	defer r.mu.Unlock()
 
-		for {
-			time.Sleep(5 * time.Second)
+	r.genID++
+	r.gen = &Generation{
+		ID:   r.genID,
+		Conn: r.conn,
+		lost: make(chan struct{}),
+	}
+	close(r.ready)
+	return r.gen
+}
+
+// endGeneration marks gen as lost and makes Generation block again until the
+// next successful reconnect.
+func (r *MsgBroker) endGeneration(gen *Generation) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	close(gen.lost)
+	r.ready = make(chan struct{})
+}
+
+func (r *MsgBroker) isClosing() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.closing
+}
 
-			if err := r.connect(); err == nil {
-				Log.Info("Successfully reconnected to message broker")
-				r.conn.NotifyClose(errChan)
+func (r *MsgBroker) handleReconnect(gen *Generation) {
+	for {
+		errChan := gen.Conn.NotifyClose(make(chan *amqp.Error, 1))
+		err := <-errChan
+		r.endGeneration(gen)
+
+		// Close marks the broker as closing before it closes the connection,
+		// so a shutdown is never mistaken for an outage.
+		if r.isClosing() {
+			return
+		}
+		Log.Error(fmt.Sprintf("Broker connection #%d lost. Attempting to reconnect...", gen.ID), err)
+
+		delay := reconnectMinDelay
+		for attempt := 1; ; attempt++ {
+			select {
+			case <-time.After(delay):
+			case <-r.done:
+				return
 			}
-			errChan = make(chan *amqp.Error)
-			r.conn.NotifyClose(errChan)
-			break
+
+			err := r.connect()
+			if err == nil {
+				if err = r.declareQueues(); err != nil {
+					_ = r.conn.Close()
+				}
+			}
+			if err == nil {
+				break
+			}
+
+			delay = min(delay*2, reconnectMaxDelay)
+			Log.Error(fmt.Sprintf("Reconnect attempt %d failed, retrying in %s", attempt, delay), err)
 		}
-		Log.Error("Failed to reconnect, retrying...", err)
+
+		gen = r.startGeneration()
+		Log.Info(fmt.Sprintf("Successfully reconnected to message broker (connection #%d)", gen.ID))
 	}
 	// End of handleReconnect
 }
 
+// Generation blocks until the broker holds a live connection and returns it.
+// Consumers call this on startup and again every time the previous generation
+// is lost.
+func (r *MsgBroker) Generation(ctx context.Context) (*Generation, error) {
+	r.mu.Lock()
+	ready := r.ready
+	r.mu.Unlock()
+
+	select {
+	case <-ready:
+	case <-r.done:
+		return nil, ErrBrokerClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.gen, nil
+}
+
+// Connected reports whether the broker currently holds a live connection.
+func (r *MsgBroker) Connected() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	select {
+	case <-r.ready:
+		return !r.closing
+	default:
+		return false
+	}
+}
+
 func (r *MsgBroker) Consume() {
 }
 
 func (r *MsgBroker) Close() error {
-	if r.channel == nil {
+	r.mu.Lock()
+	if r.closing {
+		r.mu.Unlock()
+		return nil
+	}
+	r.closing = true
+	close(r.done)
+	channel, conn := r.channel, r.conn
+	r.mu.Unlock()
+
+	if channel == nil {
 		return fmt.Errorf("no channels to rabbit-mq")
 	}
-	if r.conn == nil {
+	if conn == nil {
 		return fmt.Errorf("no connection to rabbit-mq")
 	}
 
-	if err := r.channel.Close(); err != nil {
+	// The connection may already be gone if RabbitMQ was down at shutdown
+	if err := channel.Close(); err != nil && !errors.Is(err, amqp.ErrClosed) {
 		return err
 	}
-	if err := r.conn.Close(); err != nil {
+	if err := conn.Close(); err != nil && !errors.Is(err, amqp.ErrClosed) {
 		return err
 	}
 
 	return nil
 }
-
-func (r *MsgBroker) Conn() *amqp.Connection {
-	return r.conn
-}
@@ -2,7 +2,12 @@ package pkg
 
 import (
 	"fmt"
+	"math"
 	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/knadh/koanf/parsers/toml"
 	"github.com/knadh/koanf/providers/file"
@@ -10,16 +15,372 @@ import (
 )
 
 type Config struct {
-	LogEnv      string `mapstructure:"env"`
-	RabbitMQURL string `mapstructure:"rabbitmq_url"`
-	WoC         struct {
-		WebhookURL string `mapstructure:"webhook_url"`
-		QueueName  string `mapstructure:"queue_name"`
-	} `mapstructure:"woc"`
-	AIVerse struct {
-		WebhookURL string `mapstructure:"webhook_url"`
-		QueueName  string `mapstructure:"queue_name"`
-	} `mapstructure:"aiverse"`
+	LogEnv      string          `mapstructure:"env"`
+	RabbitMQURL string          `mapstructure:"rabbitmq_url"`
+	Store       StoreConfig     `mapstructure:"store"`
+	API         APIConfig       `mapstructure:"api"`
+	Webhooks    []WebhookConfig `mapstructure:"webhooks"`
+}
+
+// APIConfig is the `[api]` table of the admin HTTP API. With Token set every
+// endpoint except the health check needs an `Authorization: Bearer <token>`
+// header.
+type APIConfig struct {
+	Listen string `mapstructure:"listen"`
+	Token  string `mapstructure:"token"`
+}
+
+// StoreConfig is the `[store]` table. Path is the SQLite database the service
+// keeps its local state in. Deliveries are remembered for DedupRetention so
+// that redelivered messages are not posted twice, and every dispatch attempt
+// is logged for AttemptRetention.
+type StoreConfig struct {
+	Path             string        `mapstructure:"path"`
+	DedupRetention   time.Duration `mapstructure:"dedup_retention"`
+	AttemptRetention time.Duration `mapstructure:"attempt_retention"`
+}
+
+// WebhookConfig is a single `[[webhooks]]` entry in env.toml. Every entry gets
+// its own consumer which decodes messages from Queue using Schema and POSTs
+// them to every one of its Destinations.
+type WebhookConfig struct {
+	Name   string      `mapstructure:"name"`
+	Queue  string      `mapstructure:"queue"`
+	Schema string      `mapstructure:"schema"`
+	Retry  RetryPolicy `mapstructure:"retry"`
+
+	Timeouts TimeoutConfig `mapstructure:"timeouts"`
+
+	// StatusCodes decides what a non-2xx response means for a message
+	StatusCodes StatusCodes `mapstructure:"status_codes"`
+
+	// CircuitBreaker stops hammering a destination that keeps failing. While
+	// the circuit of any destination is open the webhook consumes nothing.
+	CircuitBreaker BreakerConfig `mapstructure:"circuit_breaker"`
+
+	// URL is shorthand for a single destination named after the webhook.
+	// After loading, Destinations always holds every receiver.
+	URL          string              `mapstructure:"url"`
+	Destinations []DestinationConfig `mapstructure:"destinations"`
+
+	// Routes send messages to some of the Destinations only, based on their
+	// content. Destinations no route names receive every message.
+	Routes []RouteConfig `mapstructure:"routes"`
+
+	// SchemaVersion is assumed for messages that do not state their schema
+	// version, so that producers predating versioning keep working.
+	SchemaVersion int `mapstructure:"schema_version"`
+
+	// Workers is the number of deliveries dispatched in parallel. Prefetch
+	// caps how many unacked messages RabbitMQ pushes to the consumer and
+	// defaults to Workers.
+	Workers  int `mapstructure:"workers"`
+	Prefetch int `mapstructure:"prefetch"`
+
+	// PartitionKey is an optional dotted path into the message (eg: "email").
+	// Messages with the same value are dispatched in order by one worker.
+	PartitionKey string `mapstructure:"partition_key"`
+
+	Signing SigningConfig `mapstructure:"signing"`
+	Fields  []FieldConfig `mapstructure:"fields"`
+
+	// Rules add validation rules on top of the ones the payload schema
+	// declares, eg: a maximum team size for one particular event.
+	Rules []RuleConfig `mapstructure:"rules"`
+
+	Transform TransformConfig `mapstructure:"transform"`
+
+	// RateLimit applies to every destination without a rate limit of its own.
+	RateLimit RateLimitConfig `mapstructure:"rate_limit"`
+
+	// Auth is sent to every destination without credentials of its own.
+	Auth AuthConfig `mapstructure:"auth"`
+}
+
+// DestinationConfig is a `[[webhooks.destinations]]` entry, one receiver of
+// the webhook's messages. Transform replaces the webhook's transform for this
+// destination only, eg: to post a chat message instead of the registration.
+// RateLimit and Auth likewise replace the webhook's.
+type DestinationConfig struct {
+	Name      string           `mapstructure:"name"`
+	URL       string           `mapstructure:"url"`
+	Transform *TransformConfig `mapstructure:"transform"`
+	RateLimit *RateLimitConfig `mapstructure:"rate_limit"`
+	Auth      *AuthConfig      `mapstructure:"auth"`
+}
+
+// Values of AuthConfig.Type
+const (
+	AuthNone   = ""
+	AuthBearer = "bearer"
+	AuthBasic  = "basic"
+	AuthAPIKey = "api_key"
+	AuthOAuth2 = "oauth2"
+)
+
+// Header an api_key is sent in unless AuthConfig.Header says otherwise
+const defaultAPIKeyHeader = "X-API-Key"
+
+// AuthConfig is an `auth` table, the credentials sent with every request.
+// Which fields are used depends on Type:
+//
+//   - bearer: Token, as `Authorization: Bearer <token>`
+//   - basic: Username and Password
+//   - api_key: Key, in the Header (X-API-Key by default)
+//   - oauth2: a token fetched from TokenURL with the client credentials grant
+//     (ClientID, ClientSecret, Scopes and extra EndpointParams, eg: an
+//     audience), cached and refreshed before it expires
+type AuthConfig struct {
+	Type string `mapstructure:"type"`
+
+	Token string `mapstructure:"token"`
+
+	Username string `mapstructure:"username"`
+	Password string `mapstructure:"password"`
+
+	Header string `mapstructure:"header"`
+	Key    string `mapstructure:"key"`
+
+	TokenURL       string            `mapstructure:"token_url"`
+	ClientID       string            `mapstructure:"client_id"`
+	ClientSecret   string            `mapstructure:"client_secret"`
+	Scopes         []string          `mapstructure:"scopes"`
+	EndpointParams map[string]string `mapstructure:"endpoint_params"`
+}
+
+// RateLimitConfig is a token bucket shared by all workers of a webhook: it
+// refills at RequestsPerSecond and holds up to Burst requests, which defaults
+// to RequestsPerSecond rounded up. A RequestsPerSecond of 0 means no limit.
+type RateLimitConfig struct {
+	RequestsPerSecond float64 `mapstructure:"requests_per_second"`
+	Burst             int     `mapstructure:"burst"`
+}
+
+// Values of RouteConfig.Op
+const (
+	RouteOpEq       = "eq"
+	RouteOpNe       = "ne"
+	RouteOpIn       = "in"
+	RouteOpNotIn    = "not_in"
+	RouteOpContains = "contains"
+	RouteOpPrefix   = "prefix"
+	RouteOpSuffix   = "suffix"
+	RouteOpMatches  = "matches"
+	RouteOpExists   = "exists"
+)
+
+// RouteConfig is a `[[webhooks.routes]]` entry: messages whose Field compares
+// to Value according to Op are sent to Destination. Routes are evaluated in
+// order and the first match wins. Value is a list for in and not_in, a regular
+// expression for matches and unused for exists.
+type RouteConfig struct {
+	Field       string `mapstructure:"field" json:"field"`
+	Op          string `mapstructure:"op" json:"op"`
+	Value       any    `mapstructure:"value" json:"value"`
+	Destination string `mapstructure:"destination" json:"destination"`
+}
+
+// TransformConfig reshapes the message into the request a receiver expects.
+// Body (or the file at BodyFile) and every Headers value are Go templates
+// executed against the message. Without a body template the message is sent
+// as-is. ContentType defaults to application/json, in which case the rendered
+// body must be valid JSON.
+type TransformConfig struct {
+	Body        string            `mapstructure:"body"`
+	BodyFile    string            `mapstructure:"body_file"`
+	ContentType string            `mapstructure:"content_type"`
+	Headers     map[string]string `mapstructure:"headers"`
+}
+
+// RuleConfig is a `[[webhooks.rules]]` entry: a dotted path into the message
+// and a comma separated rule list in the syntax of `validate` struct tags.
+type RuleConfig struct {
+	Field string `mapstructure:"field" json:"field"`
+	Rule  string `mapstructure:"rule" json:"rule"`
+}
+
+// Values of FieldConfig.Action
+const (
+	FieldActionKeep    = "keep"
+	FieldActionDrop    = "drop"
+	FieldActionHash    = "hash"
+	FieldActionEncrypt = "encrypt"
+)
+
+// Values of FieldConfig.Hash
+const (
+	FieldHashBcrypt   = "bcrypt"
+	FieldHashArgon2id = "argon2id"
+)
+
+// FieldConfig is a `[[webhooks.fields]]` entry describing how one payload
+// field is treated. Path is a dotted path into the message where "*" matches
+// every array element. Sensitive fields never show up in logs. Action decides
+// what the receiver gets: the value as-is (keep), nothing (drop), a bcrypt or
+// argon2id hash (hash) or the value encrypted with the receiver's RSA public
+// key read from PublicKey (encrypt).
+type FieldConfig struct {
+	Path      string `mapstructure:"path" json:"path"`
+	Sensitive bool   `mapstructure:"sensitive" json:"sensitive"`
+	Action    string `mapstructure:"action" json:"action"`
+	Hash      string `mapstructure:"hash" json:"hash"`
+	PublicKey string `mapstructure:"public_key" json:"public_key"`
+}
+
+// SigningConfig holds the HMAC-SHA256 secrets used to sign outgoing requests.
+// All of them sign every request, so a new secret can be rolled out while the
+// receiver still only knows the old one. Remove the old secret once every
+// receiver has switched.
+type SigningConfig struct {
+	Secrets []string `mapstructure:"secrets"`
+}
+
+// RetryPolicy controls how often and how fast a failed dispatch is retried.
+// The delay before attempt n+1 is InitialDelay * Multiplier^(n-1), capped at
+// MaxDelay and randomly shortened by up to Jitter (a fraction between 0 and 1).
+// Attempts stop after MaxAttempts unless Unlimited is set.
+type RetryPolicy struct {
+	MaxAttempts  int           `mapstructure:"max_attempts"`
+	InitialDelay time.Duration `mapstructure:"initial_delay"`
+	Multiplier   float64       `mapstructure:"multiplier"`
+	MaxDelay     time.Duration `mapstructure:"max_delay"`
+	Jitter       float64       `mapstructure:"jitter"`
+	Unlimited    bool          `mapstructure:"unlimited"`
+}
+
+// TimeoutConfig is the `[webhooks.timeouts]` table. Connect, TLS and
+// ResponseHeader bound the phases of a dispatch, Total the whole request
+// including reading the response. On shutdown in-flight requests get
+// ShutdownGrace to finish before they are aborted and their messages requeued.
+type TimeoutConfig struct {
+	Connect        time.Duration `mapstructure:"connect"`
+	TLS            time.Duration `mapstructure:"tls"`
+	ResponseHeader time.Duration `mapstructure:"response_header"`
+	Total          time.Duration `mapstructure:"total"`
+	ShutdownGrace  time.Duration `mapstructure:"shutdown_grace"`
+}
+
+// Used for every field left out of a webhook's [webhooks.timeouts] table
+var defaultTimeouts = TimeoutConfig{
+	Connect:        5 * time.Second,
+	TLS:            5 * time.Second,
+	ResponseHeader: 10 * time.Second,
+	Total:          10 * time.Second,
+	ShutdownGrace:  5 * time.Second,
+}
+
+// Values of StatusCodes
+const (
+	StatusActionAck        = "ack"
+	StatusActionRetry      = "retry"
+	StatusActionDeadLetter = "dead_letter"
+)
+
+// StatusCodes is the `[webhooks.status_codes]` table. It maps a status code
+// ("409") or a whole class ("4xx") to what happens to a message the receiver
+// answered with it: ack treats it as delivered, retry tries again later and
+// dead_letter gives up right away. Codes win over classes and the webhook's
+// entries over the defaults, which retry 408, 425, 429 and every 5xx and
+// dead-letter the rest of the 4xx. Anything else is retried. 2xx responses
+// are always delivered.
+type StatusCodes map[string]string
+
+var defaultStatusCodes = StatusCodes{
+	"408": StatusActionRetry,
+	"425": StatusActionRetry,
+	"429": StatusActionRetry,
+	"4xx": StatusActionDeadLetter,
+	"5xx": StatusActionRetry,
+}
+
+// Action returns the StatusAction* for a response with status code.
+func (m StatusCodes) Action(code int) string {
+	exact, class := strconv.Itoa(code), fmt.Sprintf("%dxx", code/100)
+	for _, mapping := range []StatusCodes{m, defaultStatusCodes} {
+		if action, ok := mapping[exact]; ok {
+			return action
+		}
+		if action, ok := mapping[class]; ok {
+			return action
+		}
+	}
+	return StatusActionRetry
+}
+
+// BreakerConfig is the `[webhooks.circuit_breaker]` table, applied to every
+// destination of the webhook on its own. FailureThreshold consecutive failed
+// dispatches open the circuit. After CoolDown a single probe is let through
+// (half-open), and SuccessThreshold successful probes in a row close the
+// circuit again while a failed one re-opens it.
+type BreakerConfig struct {
+	FailureThreshold int           `mapstructure:"failure_threshold"`
+	CoolDown         time.Duration `mapstructure:"cool_down"`
+	SuccessThreshold int           `mapstructure:"success_threshold"`
+	Disabled         bool          `mapstructure:"disabled"`
+}
+
+// Short HMAC keys are easy to brute force from a single captured request
+const minSecretLength = 16
+
+// Policies with a multiplier close to 1 would need a retry queue for nearly
+// every attempt. Past this many tiers the remaining attempts share MaxDelay.
+const maxRetryTiers = 32
+
+// Backoff is the delay after the given (1-based) failed attempt, without
+// jitter and rounded to milliseconds (the resolution of RabbitMQ TTLs).
+func (p RetryPolicy) Backoff(attempt int) time.Duration {
+	delay := float64(p.InitialDelay) * math.Pow(p.Multiplier, float64(attempt-1))
+	if delay > float64(p.MaxDelay) {
+		return p.MaxDelay.Round(time.Millisecond)
+	}
+	return time.Duration(delay).Round(time.Millisecond)
+}
+
+// Tiers lists the distinct delays a message can wait between two attempts, in
+// ascending order. Each one becomes a retry queue. Unless no retry is allowed
+// at all, the last one is always MaxDelay, so that a receiver asking for a
+// longer wait through Retry-After gets up to MaxDelay even when the backoff
+// never gets there.
+func (p RetryPolicy) Tiers() []time.Duration {
+	var tiers []time.Duration
+	for attempt := 1; len(tiers) < maxRetryTiers; attempt++ {
+		if !p.Unlimited && attempt >= p.MaxAttempts {
+			break
+		}
+		delay := p.Backoff(attempt)
+		if len(tiers) > 0 && delay == tiers[len(tiers)-1] {
+			break // Multiplier of 1 or MaxDelay reached
+		}
+		tiers = append(tiers, delay)
+	}
+
+	maxDelay := p.MaxDelay.Round(time.Millisecond)
+	switch {
+	case len(tiers) == 0 || tiers[len(tiers)-1] == maxDelay:
+	case len(tiers) == maxRetryTiers:
+		tiers[len(tiers)-1] = maxDelay
+	default:
+		tiers = append(tiers, maxDelay)
+	}
+	return tiers
+}
+
+// Used for every field left out of a webhook's [webhooks.retry] table. With
+// these values a message is given up on after roughly ten minutes.
+var defaultRetryPolicy = RetryPolicy{
+	MaxAttempts:  8,
+	InitialDelay: 5 * time.Second,
+	Multiplier:   2,
+	MaxDelay:     5 * time.Minute,
+	Jitter:       0.2,
+}
+
+// Used for every field left out of a webhook's [webhooks.circuit_breaker]
+// table.
+var defaultBreakerConfig = BreakerConfig{
+	FailureThreshold: 5,
+	CoolDown:         30 * time.Second,
+	SuccessThreshold: 1,
 }
 
 var AppConfig *Config
@@ -32,24 +393,404 @@ func LoadConfig() error {
 	}
 
 	var config Config
-	if err := koa.Unmarshal("", &config); err != nil {
+	// koanf looks for `koanf` struct tags unless told otherwise
+	if err := koa.UnmarshalWithConf("", &config, koanf.UnmarshalConf{Tag: "mapstructure"}); err != nil {
 		return fmt.Errorf("failed to unmarshal config: %w", err)
 	}
 
 	if err := validateURL(config.RabbitMQURL); err != nil {
 		return fmt.Errorf("invalid RabbitMQ URL: %w", err)
 	}
-	if err := validateURL(config.WoC.WebhookURL); err != nil {
-		return fmt.Errorf("invalid WoC webhook URL: %w", err)
+	if err := validateWebhooks(config.Webhooks); err != nil {
+		return err
+	}
+	if config.Store.Path == "" {
+		config.Store.Path = "termite.db"
+	}
+	if config.Store.DedupRetention == 0 {
+		config.Store.DedupRetention = 7 * 24 * time.Hour
+	}
+	if config.API.Listen == "" {
+		config.API.Listen = "127.0.0.1:8090"
 	}
-	if err := validateURL(config.AIVerse.WebhookURL); err != nil {
-		return fmt.Errorf("invalid AIVerse webhook URL: %w", err)
+	if config.Store.AttemptRetention == 0 {
+		config.Store.AttemptRetention = 30 * 24 * time.Hour
+	}
+	if config.Store.DedupRetention < 0 || config.Store.AttemptRetention < 0 {
+		return fmt.Errorf("retention of the store must not be negative")
 	}
 
 	AppConfig = &config
 	return nil
 }
 
+// Topology returns the queues the broker has to declare for every configured
+// webhook in config order.
+func (c *Config) Topology() []QueueTopology {
+	queues := make([]QueueTopology, 0, len(c.Webhooks))
+	for _, hook := range c.Webhooks {
+		queues = append(queues, QueueTopology{
+			Queue:       hook.Queue,
+			RetryDelays: hook.Retry.Tiers(),
+		})
+	}
+	return queues
+}
+
+func validateWebhooks(webhooks []WebhookConfig) error {
+	if len(webhooks) == 0 {
+		return fmt.Errorf("no webhooks configured, add at least one [[webhooks]] entry")
+	}
+
+	names := make(map[string]bool, len(webhooks))
+	queues := make(map[string]string, len(webhooks))
+	for i, hook := range webhooks {
+		if hook.Name == "" {
+			return fmt.Errorf("webhook #%d has no name", i+1)
+		}
+		if names[hook.Name] {
+			return fmt.Errorf("duplicate webhook name %q", hook.Name)
+		}
+		names[hook.Name] = true
+
+		if hook.Queue == "" {
+			return fmt.Errorf("webhook %s has no queue", hook.Name)
+		}
+		// Two consumers on one queue would round-robin messages between two
+		// different receivers, which is never what is intended.
+		if other, ok := queues[hook.Queue]; ok {
+			return fmt.Errorf("webhooks %s and %s both consume queue %q", other, hook.Name, hook.Queue)
+		}
+		queues[hook.Queue] = hook.Name
+		if hook.Schema == "" {
+			return fmt.Errorf("webhook %s has no schema", hook.Name)
+		}
+		if err := validateDestinations(&webhooks[i]); err != nil {
+			return err
+		}
+
+		if hook.SchemaVersion == 0 {
+			webhooks[i].SchemaVersion = 1
+		}
+		if hook.Workers == 0 {
+			webhooks[i].Workers = 1
+		}
+		if hook.Prefetch == 0 {
+			webhooks[i].Prefetch = webhooks[i].Workers
+		}
+		if webhooks[i].Workers < 1 {
+			return fmt.Errorf("webhook %s needs at least one worker", hook.Name)
+		}
+		// Workers beyond the prefetch count would never get a message
+		if webhooks[i].Prefetch < webhooks[i].Workers {
+			return fmt.Errorf("prefetch of webhook %s must be at least its number of workers", hook.Name)
+		}
+
+		for _, secret := range hook.Signing.Secrets {
+			if len(secret) < minSecretLength {
+				return fmt.Errorf("signing secrets of webhook %s must be at least %d characters", hook.Name, minSecretLength)
+			}
+		}
+
+		for j := range hook.Fields {
+			if err := validateField(&webhooks[i].Fields[j]); err != nil {
+				return fmt.Errorf("invalid field policy for webhook %s: %w", hook.Name, err)
+			}
+		}
+
+		for j, route := range hook.Routes {
+			if err := validateRoute(route, webhooks[i].Destinations); err != nil {
+				return fmt.Errorf("invalid route #%d for webhook %s: %w", j+1, hook.Name, err)
+			}
+		}
+
+		if err := validateTransform(hook.Transform); err != nil {
+			return fmt.Errorf("invalid transform for webhook %s: %w", hook.Name, err)
+		}
+
+		applyRetryDefaults(&webhooks[i].Retry)
+		if err := validateRetryPolicy(webhooks[i].Retry); err != nil {
+			return fmt.Errorf("invalid retry policy for webhook %s: %w", hook.Name, err)
+		}
+
+		if err := applyTimeoutDefaults(&webhooks[i].Timeouts); err != nil {
+			return fmt.Errorf("invalid timeouts for webhook %s: %w", hook.Name, err)
+		}
+
+		if err := validateStatusCodes(hook.StatusCodes); err != nil {
+			return fmt.Errorf("invalid status_codes for webhook %s: %w", hook.Name, err)
+		}
+
+		applyBreakerDefaults(&webhooks[i].CircuitBreaker)
+		if err := validateBreaker(webhooks[i].CircuitBreaker); err != nil {
+			return fmt.Errorf("invalid circuit breaker for webhook %s: %w", hook.Name, err)
+		}
+	}
+	return nil
+}
+
+// validateDestinations turns the url shorthand into a destination and checks
+// that every destination can be told apart in message headers.
+func validateDestinations(hook *WebhookConfig) error {
+	if hook.URL != "" {
+		if len(hook.Destinations) > 0 {
+			return fmt.Errorf("webhook %s sets both url and destinations", hook.Name)
+		}
+		hook.Destinations = []DestinationConfig{{Name: hook.Name, URL: hook.URL}}
+	}
+	if len(hook.Destinations) == 0 {
+		return fmt.Errorf("webhook %s has no url or destinations", hook.Name)
+	}
+
+	names := make(map[string]bool, len(hook.Destinations))
+	for i, dest := range hook.Destinations {
+		if dest.Name == "" {
+			return fmt.Errorf("destination #%d of webhook %s has no name", i+1, hook.Name)
+		}
+		if names[dest.Name] {
+			return fmt.Errorf("duplicate destination %q in webhook %s", dest.Name, hook.Name)
+		}
+		names[dest.Name] = true
+
+		if err := validateURL(dest.URL); err != nil {
+			return fmt.Errorf("invalid URL for destination %s of webhook %s: %w", dest.Name, hook.Name, err)
+		}
+		if dest.Transform != nil {
+			if err := validateTransform(*dest.Transform); err != nil {
+				return fmt.Errorf("invalid transform for destination %s of webhook %s: %w", dest.Name, hook.Name, err)
+			}
+		}
+		if dest.RateLimit != nil {
+			if err := validateRateLimit(*dest.RateLimit); err != nil {
+				return fmt.Errorf("invalid rate limit for destination %s of webhook %s: %w", dest.Name, hook.Name, err)
+			}
+		}
+		if dest.Auth != nil {
+			if err := validateAuth(dest.Auth); err != nil {
+				return fmt.Errorf("invalid auth for destination %s of webhook %s: %w", dest.Name, hook.Name, err)
+			}
+		}
+	}
+	if err := validateRateLimit(hook.RateLimit); err != nil {
+		return fmt.Errorf("invalid rate limit for webhook %s: %w", hook.Name, err)
+	}
+	if err := validateAuth(&hook.Auth); err != nil {
+		return fmt.Errorf("invalid auth for webhook %s: %w", hook.Name, err)
+	}
+	return nil
+}
+
+// validateAuth checks that auth has what its type needs and fills in the
+// default api_key header.
+func validateAuth(auth *AuthConfig) error {
+	switch auth.Type {
+	case AuthNone:
+	case AuthBearer:
+		if auth.Token == "" {
+			return fmt.Errorf("bearer needs a token")
+		}
+	case AuthBasic:
+		if auth.Username == "" {
+			return fmt.Errorf("basic needs a username")
+		}
+	case AuthAPIKey:
+		if auth.Key == "" {
+			return fmt.Errorf("api_key needs a key")
+		}
+		if auth.Header == "" {
+			auth.Header = defaultAPIKeyHeader
+		}
+	case AuthOAuth2:
+		if auth.ClientID == "" || auth.ClientSecret == "" {
+			return fmt.Errorf("oauth2 needs a client_id and a client_secret")
+		}
+		if err := validateURL(auth.TokenURL); err != nil {
+			return fmt.Errorf("invalid token_url: %w", err)
+		}
+	default:
+		return fmt.Errorf("unknown type %q", auth.Type)
+	}
+	return nil
+}
+
+func validateRateLimit(limit RateLimitConfig) error {
+	if limit.RequestsPerSecond < 0 {
+		return fmt.Errorf("requests_per_second must not be negative")
+	}
+	if limit.Burst < 0 {
+		return fmt.Errorf("burst must not be negative")
+	}
+	return nil
+}
+
+func validateRoute(route RouteConfig, destinations []DestinationConfig) error {
+	if route.Field == "" {
+		return fmt.Errorf("route without a field")
+	}
+	if !slices.ContainsFunc(destinations, func(d DestinationConfig) bool { return d.Name == route.Destination }) {
+		return fmt.Errorf("unknown destination %q", route.Destination)
+	}
+
+	switch route.Op {
+	case RouteOpExists:
+	case RouteOpIn, RouteOpNotIn:
+		if _, ok := route.Value.([]any); !ok {
+			return fmt.Errorf("%s needs a list value", route.Op)
+		}
+	case RouteOpEq, RouteOpNe, RouteOpContains, RouteOpPrefix, RouteOpSuffix, RouteOpMatches:
+		if route.Value == nil {
+			return fmt.Errorf("%s needs a value", route.Op)
+		}
+		if _, ok := route.Value.([]any); ok {
+			return fmt.Errorf("%s needs a single value, use in for lists", route.Op)
+		}
+	default:
+		return fmt.Errorf("unknown op %q", route.Op)
+	}
+	return nil
+}
+
+func validateTransform(transform TransformConfig) error {
+	if transform.Body != "" && transform.BodyFile != "" {
+		return fmt.Errorf("both body and body_file are set")
+	}
+	return nil
+}
+
+func validateField(field *FieldConfig) error {
+	if field.Path == "" {
+		return fmt.Errorf("field without a path")
+	}
+	if field.Action == "" {
+		field.Action = FieldActionKeep
+	}
+
+	switch field.Action {
+	case FieldActionKeep, FieldActionDrop:
+	case FieldActionHash:
+		if field.Hash == "" {
+			field.Hash = FieldHashBcrypt
+		}
+		if field.Hash != FieldHashBcrypt && field.Hash != FieldHashArgon2id {
+			return fmt.Errorf("field %s: unknown hash %q", field.Path, field.Hash)
+		}
+	case FieldActionEncrypt:
+		if field.PublicKey == "" {
+			return fmt.Errorf("field %s: encrypt needs a public_key", field.Path)
+		}
+	default:
+		return fmt.Errorf("field %s: unknown action %q", field.Path, field.Action)
+	}
+	return nil
+}
+
+func applyRetryDefaults(policy *RetryPolicy) {
+	if policy.MaxAttempts == 0 {
+		policy.MaxAttempts = defaultRetryPolicy.MaxAttempts
+	}
+	if policy.InitialDelay == 0 {
+		policy.InitialDelay = defaultRetryPolicy.InitialDelay
+	}
+	if policy.Multiplier == 0 {
+		policy.Multiplier = defaultRetryPolicy.Multiplier
+	}
+	if policy.MaxDelay == 0 {
+		policy.MaxDelay = max(defaultRetryPolicy.MaxDelay, policy.InitialDelay)
+	}
+	// Jitter is left alone as 0 is a meaningful value (fixed delays)
+}
+
+func validateRetryPolicy(policy RetryPolicy) error {
+	if policy.MaxAttempts < 1 {
+		return fmt.Errorf("max_attempts must be at least 1")
+	}
+	if policy.InitialDelay < time.Millisecond {
+		return fmt.Errorf("initial_delay must be at least 1ms")
+	}
+	if policy.Multiplier < 1 {
+		return fmt.Errorf("multiplier must be at least 1")
+	}
+	if policy.MaxDelay < policy.InitialDelay {
+		return fmt.Errorf("max_delay must not be shorter than initial_delay")
+	}
+	if policy.Jitter < 0 || policy.Jitter > 1 {
+		return fmt.Errorf("jitter must be between 0 and 1")
+	}
+	return nil
+}
+
+// applyTimeoutDefaults fills in left out timeouts and rejects negative ones.
+func applyTimeoutDefaults(timeouts *TimeoutConfig) error {
+	fields := []struct {
+		name     string
+		value    *time.Duration
+		fallback time.Duration
+	}{
+		{"connect", &timeouts.Connect, defaultTimeouts.Connect},
+		{"tls", &timeouts.TLS, defaultTimeouts.TLS},
+		{"response_header", &timeouts.ResponseHeader, defaultTimeouts.ResponseHeader},
+		{"total", &timeouts.Total, defaultTimeouts.Total},
+		{"shutdown_grace", &timeouts.ShutdownGrace, defaultTimeouts.ShutdownGrace},
+	}
+	for _, field := range fields {
+		if *field.value < 0 {
+			return fmt.Errorf("%s must not be negative", field.name)
+		}
+		if *field.value == 0 {
+			*field.value = field.fallback
+		}
+	}
+	return nil
+}
+
+func validateStatusCodes(codes StatusCodes) error {
+	for key, action := range codes {
+		code, err := strconv.Atoi(strings.TrimSuffix(key, "xx"))
+		switch {
+		case err != nil:
+			return fmt.Errorf("%q is neither a status code nor a class like 4xx", key)
+		case strings.HasSuffix(key, "xx") && (code < 1 || code > 5 || len(key) != 3):
+			return fmt.Errorf("unknown status class %q", key)
+		case !strings.HasSuffix(key, "xx") && (code < 100 || code > 599):
+			return fmt.Errorf("unknown status code %q", key)
+		case key == "2xx" || (code >= 200 && code < 300):
+			return fmt.Errorf("%s: 2xx responses are always delivered", key)
+		}
+
+		switch action {
+		case StatusActionAck, StatusActionRetry, StatusActionDeadLetter:
+		default:
+			return fmt.Errorf("%s: unknown action %q", key, action)
+		}
+	}
+	return nil
+}
+
+func applyBreakerDefaults(config *BreakerConfig) {
+	if config.FailureThreshold == 0 {
+		config.FailureThreshold = defaultBreakerConfig.FailureThreshold
+	}
+	if config.CoolDown == 0 {
+		config.CoolDown = defaultBreakerConfig.CoolDown
+	}
+	if config.SuccessThreshold == 0 {
+		config.SuccessThreshold = defaultBreakerConfig.SuccessThreshold
+	}
+}
+
+func validateBreaker(config BreakerConfig) error {
+	if config.FailureThreshold < 1 {
+		return fmt.Errorf("failure_threshold must be at least 1")
+	}
+	if config.CoolDown < time.Second {
+		return fmt.Errorf("cool_down must be at least 1s")
+	}
+	if config.SuccessThreshold < 1 {
+		return fmt.Errorf("success_threshold must be at least 1")
+	}
+	return nil
+}
+
 func validateURL(rawURL string) error {
 	_, err := url.ParseRequestURI(rawURL)
 	if err != nil {
@@ -0,0 +1,88 @@
+package pkg
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyTiers(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy RetryPolicy
+		want   []time.Duration
+	}{
+		{
+			name:   "default policy reaches max_delay",
+			policy: defaultRetryPolicy,
+			want: []time.Duration{5 * time.Second, 10 * time.Second, 20 * time.Second, 40 * time.Second,
+				80 * time.Second, 160 * time.Second, 5 * time.Minute},
+		},
+		{
+			name:   "max_delay is declared before the backoff gets there",
+			policy: RetryPolicy{MaxAttempts: 3, InitialDelay: 5 * time.Second, Multiplier: 2, MaxDelay: 5 * time.Minute},
+			want:   []time.Duration{5 * time.Second, 10 * time.Second, 5 * time.Minute},
+		},
+		{
+			name:   "fixed delay",
+			policy: RetryPolicy{Unlimited: true, InitialDelay: 5 * time.Second, Multiplier: 1, MaxDelay: 5 * time.Second},
+			want:   []time.Duration{5 * time.Second},
+		},
+		{
+			name:   "no retries",
+			policy: RetryPolicy{MaxAttempts: 1, InitialDelay: 5 * time.Second, Multiplier: 2, MaxDelay: time.Minute},
+			want:   nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.Tiers(); !slices.Equal(got, tt.want) {
+				t.Fatalf("Tiers() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryPolicyTiersAreCapped(t *testing.T) {
+	policy := RetryPolicy{Unlimited: true, InitialDelay: time.Second, Multiplier: 1.01, MaxDelay: time.Hour}
+	tiers := policy.Tiers()
+	if len(tiers) != maxRetryTiers {
+		t.Fatalf("%d tiers, want %d", len(tiers), maxRetryTiers)
+	}
+	if last := tiers[len(tiers)-1]; last != policy.MaxDelay {
+		t.Fatalf("last tier = %s, want max_delay %s", last, policy.MaxDelay)
+	}
+}
+
+func TestStatusCodesAction(t *testing.T) {
+	mapping := StatusCodes{
+		"409": StatusActionAck,
+		"503": StatusActionDeadLetter,
+		"3xx": StatusActionDeadLetter,
+	}
+
+	tests := []struct {
+		name    string
+		mapping StatusCodes
+		code    int
+		want    string
+	}{
+		{"default 4xx", nil, 400, StatusActionDeadLetter},
+		{"default 408", nil, 408, StatusActionRetry},
+		{"default 429", nil, 429, StatusActionRetry},
+		{"default 5xx", nil, 502, StatusActionRetry},
+		{"unmapped class", nil, 302, StatusActionRetry},
+		{"webhook code", mapping, 409, StatusActionAck},
+		{"webhook code over default class", mapping, 503, StatusActionDeadLetter},
+		{"webhook class", mapping, 301, StatusActionDeadLetter},
+		{"default code next to webhook codes", mapping, 429, StatusActionRetry},
+		{"webhook class over default code", StatusCodes{"4xx": StatusActionAck}, 429, StatusActionAck},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.mapping.Action(tt.code); got != tt.want {
+				t.Fatalf("Action(%d) = %q, want %q", tt.code, got, tt.want)
+			}
+		})
+	}
+}
@@ -124,6 +124,9 @@ func (l *LoggerService) Error(msg string, err error) {
 	l.Logger.WithLevel(zerolog.InfoLevel).Err(err).Msg(msg)
 }
 
+// Fatal logs and exits. WithLevel never exits on its own, so callers that
+// treated Fatal as terminal used to carry on with nil values.
 func (l *LoggerService) Fatal(msg string, err error) {
 	l.Logger.WithLevel(zerolog.FatalLevel).Err(err).Msg(msg)
+	os.Exit(1)
 }
@@ -0,0 +1,285 @@
+package pkg
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// How often rows past their retention are deleted
+const pruneInterval = time.Hour
+
+var DB *Store
+
+// Store is the local SQLite database of the service. It is safe for
+// concurrent use by all consumers.
+type Store struct {
+	db *sql.DB
+}
+
+var migrations = []string{
+	`CREATE TABLE IF NOT EXISTS deliveries (
+		webhook      TEXT NOT NULL,
+		destination  TEXT NOT NULL,
+		key          TEXT NOT NULL,
+		delivered_at INTEGER NOT NULL,
+		PRIMARY KEY (webhook, destination, key)
+	)`,
+	`CREATE INDEX IF NOT EXISTS deliveries_delivered_at ON deliveries (delivered_at)`,
+	`CREATE TABLE IF NOT EXISTS attempts (
+		id           INTEGER PRIMARY KEY AUTOINCREMENT,
+		webhook      TEXT NOT NULL,
+		destination  TEXT NOT NULL,
+		message_id   TEXT NOT NULL,
+		description  TEXT NOT NULL,
+		attempt      INTEGER NOT NULL,
+		body_sha256  TEXT NOT NULL,
+		status       INTEGER NOT NULL,
+		response     TEXT NOT NULL,
+		latency_ms   INTEGER NOT NULL,
+		error        TEXT NOT NULL,
+		attempted_at INTEGER NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS attempts_attempted_at ON attempts (attempted_at)`,
+	`CREATE INDEX IF NOT EXISTS attempts_message_id ON attempts (message_id)`,
+}
+
+// Attempt is a single dispatch of a message to one destination. Status is 0
+// when no response was received, Response holds the start of the response
+// body.
+type Attempt struct {
+	ID          int64         `json:"id"`
+	Webhook     string        `json:"webhook"`
+	Destination string        `json:"destination"`
+	MessageID   string        `json:"message_id"`
+	Description string        `json:"description"`
+	Attempt     int           `json:"attempt"`
+	BodySHA256  string        `json:"body_sha256"`
+	Status      int           `json:"status"`
+	Response    string        `json:"response"`
+	Latency     time.Duration `json:"-"`
+	Error       string        `json:"error"`
+	AttemptedAt time.Time     `json:"attempted_at"`
+}
+
+// MarshalJSON reports the latency in milliseconds, like the database does.
+func (a Attempt) MarshalJSON() ([]byte, error) {
+	type plain Attempt
+	return json.Marshal(struct {
+		plain
+		Latency int64 `json:"latency_ms"`
+	}{plain(a), a.Latency.Milliseconds()})
+}
+
+// AttemptFilter selects logged attempts. Empty fields match everything,
+// Description matches a substring. Attempts are returned newest first, at most
+// Limit of them and only those with an ID below Before, if set.
+type AttemptFilter struct {
+	Webhook     string
+	Destination string
+	MessageID   string
+	Description string
+	Before      int64
+	Limit       int
+}
+
+// DestinationStats summarises the logged attempts of one destination.
+type DestinationStats struct {
+	Destination   string    `json:"destination"`
+	Attempts      int       `json:"attempts"`
+	Succeeded     int       `json:"succeeded"`
+	Failed        int       `json:"failed"`
+	Messages      int       `json:"messages"`
+	AvgLatencyMs  float64   `json:"avg_latency_ms"`
+	MaxLatencyMs  int64     `json:"max_latency_ms"`
+	LastAttemptAt time.Time `json:"last_attempt_at"`
+	LastSuccessAt time.Time `json:"last_success_at,omitzero"`
+}
+
+// OpenStore opens (and creates, if needed) the database at path.
+func OpenStore(path string) (*Store, error) {
+	// WAL lets readers run next to the single writer, busy_timeout makes
+	// writers from different workers wait for each other instead of failing.
+	dsn := fmt.Sprintf("file:%s?_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)", path)
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open store: %w", err)
+	}
+
+	for _, migration := range migrations {
+		if _, err := db.Exec(migration); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("failed to migrate store: %w", err)
+		}
+	}
+	return &Store{db: db}, nil
+}
+
+// Delivered reports whether the message with the given idempotency key was
+// already delivered to destination of webhook.
+func (s *Store) Delivered(ctx context.Context, webhook, destination, key string) (bool, error) {
+	var found int
+	err := s.db.QueryRowContext(ctx,
+		`SELECT 1 FROM deliveries WHERE webhook = ? AND destination = ? AND key = ?`,
+		webhook, destination, key,
+	).Scan(&found)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// MarkDelivered records a successful delivery.
+func (s *Store) MarkDelivered(ctx context.Context, webhook, destination, key string) error {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT OR REPLACE INTO deliveries (webhook, destination, key, delivered_at) VALUES (?, ?, ?, ?)`,
+		webhook, destination, key, time.Now().Unix(),
+	)
+	return err
+}
+
+// RecordAttempt adds a to the delivery log.
+func (s *Store) RecordAttempt(ctx context.Context, a Attempt) error {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO attempts (webhook, destination, message_id, description, attempt, body_sha256,
+			status, response, latency_ms, error, attempted_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		a.Webhook, a.Destination, a.MessageID, a.Description, a.Attempt, a.BodySHA256,
+		a.Status, a.Response, a.Latency.Milliseconds(), a.Error, a.AttemptedAt.Unix(),
+	)
+	return err
+}
+
+// Attempts returns the logged attempts matching filter.
+func (s *Store) Attempts(ctx context.Context, filter AttemptFilter) ([]Attempt, error) {
+	query := `SELECT id, webhook, destination, message_id, description, attempt, body_sha256,
+		status, response, latency_ms, error, attempted_at FROM attempts WHERE 1 = 1`
+	var args []any
+	if filter.Webhook != "" {
+		query += ` AND webhook = ?`
+		args = append(args, filter.Webhook)
+	}
+	if filter.Destination != "" {
+		query += ` AND destination = ?`
+		args = append(args, filter.Destination)
+	}
+	if filter.MessageID != "" {
+		query += ` AND message_id = ?`
+		args = append(args, filter.MessageID)
+	}
+	if filter.Description != "" {
+		query += ` AND instr(description, ?) > 0`
+		args = append(args, filter.Description)
+	}
+	if filter.Before > 0 {
+		query += ` AND id < ?`
+		args = append(args, filter.Before)
+	}
+	query += ` ORDER BY id DESC LIMIT ?`
+	args = append(args, filter.Limit)
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	attempts := []Attempt{}
+	for rows.Next() {
+		var a Attempt
+		var latencyMs, attemptedAt int64
+		err := rows.Scan(&a.ID, &a.Webhook, &a.Destination, &a.MessageID, &a.Description, &a.Attempt,
+			&a.BodySHA256, &a.Status, &a.Response, &latencyMs, &a.Error, &attemptedAt)
+		if err != nil {
+			return nil, err
+		}
+		a.Latency = time.Duration(latencyMs) * time.Millisecond
+		a.AttemptedAt = time.Unix(attemptedAt, 0).UTC()
+		attempts = append(attempts, a)
+	}
+	return attempts, rows.Err()
+}
+
+// Stats summarises the attempts of webhook since the given time, per
+// destination.
+func (s *Store) Stats(ctx context.Context, webhook string, since time.Time) ([]DestinationStats, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT destination, COUNT(*),
+			COALESCE(SUM(error = ''), 0),
+			COUNT(DISTINCT message_id),
+			AVG(latency_ms), MAX(latency_ms), MAX(attempted_at),
+			COALESCE(MAX(CASE WHEN error = '' THEN attempted_at END), 0)
+		FROM attempts WHERE webhook = ? AND attempted_at >= ?
+		GROUP BY destination ORDER BY destination`,
+		webhook, since.Unix(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stats := []DestinationStats{}
+	for rows.Next() {
+		var st DestinationStats
+		var lastAttempt, lastSuccess int64
+		err := rows.Scan(&st.Destination, &st.Attempts, &st.Succeeded, &st.Messages,
+			&st.AvgLatencyMs, &st.MaxLatencyMs, &lastAttempt, &lastSuccess)
+		if err != nil {
+			return nil, err
+		}
+		st.Failed = st.Attempts - st.Succeeded
+		st.LastAttemptAt = time.Unix(lastAttempt, 0).UTC()
+		if lastSuccess > 0 {
+			st.LastSuccessAt = time.Unix(lastSuccess, 0).UTC()
+		}
+		stats = append(stats, st)
+	}
+	return stats, rows.Err()
+}
+
+// Ping checks that the database can be reached.
+func (s *Store) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+// Prune deletes rows past their retention right away and then every
+// pruneInterval until ctx is cancelled.
+func (s *Store) Prune(ctx context.Context, config StoreConfig) {
+	ticker := time.NewTicker(pruneInterval)
+	defer ticker.Stop()
+
+	for {
+		s.prune(ctx, "delivery records", `DELETE FROM deliveries WHERE delivered_at < ?`, config.DedupRetention)
+		s.prune(ctx, "logged attempts", `DELETE FROM attempts WHERE attempted_at < ?`, config.AttemptRetention)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Store) prune(ctx context.Context, what, query string, retention time.Duration) {
+	result, err := s.db.ExecContext(ctx, query, time.Now().Add(-retention).Unix())
+	if err != nil {
+		if ctx.Err() == nil {
+			Log.Error(fmt.Sprintf("Failed to prune %s", what), err)
+		}
+		return
+	}
+	if n, _ := result.RowsAffected(); n > 0 {
+		Log.Info(fmt.Sprintf("Pruned %d %s", n, what))
+	}
+}
+
+func (s *Store) Close() error {
+	return s.db.Close()
+}
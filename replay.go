@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/IAmRiteshKoushik/termite/consumer"
+	"github.com/IAmRiteshKoushik/termite/pkg"
+)
+
+// replay lists the dead-lettered messages of a webhook and, with -apply,
+// moves them back into its queue, eg:
+//
+//	termite replay -webhook aiverse -since 2h -reason retries-exhausted
+//	termite replay -webhook aiverse -where team_name=Rocket -set leader_phone_number=+919999999999 -apply
+//	termite replay -webhook woc -id 8f14e45f -body fixed.json -apply
+//
+// Matching messages are printed as JSON. It returns the process exit code.
+func replay(args []string) int {
+	flags := flag.NewFlagSet("replay", flag.ContinueOnError)
+	name := flags.String("webhook", "", "name of the [[webhooks]] entry whose dead-letter queue is read")
+	since := flags.Duration("since", 0, "only messages that failed within this duration")
+	from := flags.String("from", "", "only messages that failed at or after this time (RFC 3339)")
+	until := flags.String("until", "", "only messages that failed before this time (RFC 3339)")
+	reason := flags.String("reason", "", "only messages dead-lettered for this reason")
+	destination := flags.String("destination", "", "only messages dead-lettered for this destination")
+	id := flags.String("id", "", "only the message with this message id")
+	where := flags.String("where", "", "only messages whose payload has field=value")
+	limit := flags.Int("limit", 0, "at most this many messages, 0 for all")
+	bodyFile := flags.String("body", "", "replace the body of the (single) matching message with this file")
+	apply := flags.Bool("apply", false, "republish the matching messages instead of only listing them")
+
+	edit := consumer.ReplayEdit{Set: map[string]any{}}
+	flags.Func("set", "set field=value in every replayed message, value is JSON or a string, can be repeated", func(s string) error {
+		path, raw, ok := strings.Cut(s, "=")
+		if !ok {
+			return fmt.Errorf("expected field=value")
+		}
+		var value any
+		if err := json.Unmarshal([]byte(raw), &value); err != nil {
+			value = raw
+		}
+		edit.Set[path] = value
+		return nil
+	})
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	hook, ok := findWebhook(*name)
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown webhook %q\n", *name)
+		return 2
+	}
+
+	filter := consumer.DeadLetterFilter{
+		Reason:      *reason,
+		Destination: *destination,
+		MessageID:   *id,
+		Limit:       *limit,
+	}
+	if *since > 0 {
+		filter.From = time.Now().Add(-*since)
+	}
+	times := map[string]struct {
+		value  string
+		target *time.Time
+	}{
+		"from":  {*from, &filter.From},
+		"until": {*until, &filter.Until},
+	}
+	for name, flagTime := range times {
+		if flagTime.value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, flagTime.value)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid -%s %q: %v\n", name, flagTime.value, err)
+			return 2
+		}
+		*flagTime.target = t
+	}
+	if *where != "" {
+		field, value, ok := strings.Cut(*where, "=")
+		if !ok {
+			fmt.Fprintln(os.Stderr, "-where expects field=value")
+			return 2
+		}
+		filter.Field, filter.Value = field, value
+	}
+	if *bodyFile != "" {
+		body, err := os.ReadFile(*bodyFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to read replacement body: %v\n", err)
+			return 1
+		}
+		edit.Body = body
+	}
+	if (len(edit.Set) > 0 || len(edit.Body) > 0) && !*apply {
+		fmt.Fprintln(os.Stderr, "-set and -body only take effect together with -apply")
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	broker, err := pkg.NewBroker(pkg.AppConfig.RabbitMQURL, pkg.AppConfig.Topology())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to connect to RabbitMQ: %v\n", err)
+		return 1
+	}
+	defer broker.Close()
+
+	c, err := consumer.NewWebhookConsumer(hook, broker, nil)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	var messages []consumer.DeadLetter
+	if *apply {
+		messages, err = c.Replay(ctx, filter, edit)
+	} else {
+		messages, err = c.DeadLetters(ctx, filter)
+	}
+	// Whatever was replayed before an error is still reported
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if encodeErr := encoder.Encode(messages); encodeErr != nil {
+		fmt.Fprintf(os.Stderr, "failed to print messages: %v\n", encodeErr)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	if *apply {
+		fmt.Fprintf(os.Stderr, "replayed %d messages into %s\n", len(messages), hook.Queue)
+	} else {
+		fmt.Fprintf(os.Stderr, "%d matching messages in %s, add -apply to replay them\n",
+			len(messages), pkg.DeadLetterQueue(hook.Queue))
+	}
+	return 0
+}
@@ -7,7 +7,7 @@ USERNAME="guest"
 PASSWORD="guest"
 VHOST="%2f"
 EXCHANGE_NAME=""
-ROUTING_KEY="ai-hackathon-registrations"
+ROUTING_KEY="${ROUTING_KEY:-ai-hackathon-registrations}" # Must match the queue of the webhook
 
 # The Team Data
 TEAM_DATA='[
@@ -17,7 +17,7 @@ TEAM_DATA='[
     "leader_email": "aarav.mehta.dev@gmail.com",
     "leader_phone_number": "9820012345",
     "leader_college_name": "BITS Pilani",
-    "problem_statement": "agentic_ai",
+    "problem_statements": ["agentic_ai", "generative_ai"],
     "team_members": [
       {
         "name": "Ishani Roy",
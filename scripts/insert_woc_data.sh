@@ -7,7 +7,7 @@ USERNAME="guest"
 PASSWORD="guest"
 VHOST="%2f" # Default vhost '/' is URL-encoded as %2f
 EXCHANGE_NAME=""
-ROUTING_KEY="woc-registrations"
+ROUTING_KEY="${ROUTING_KEY:-woc-registrations}" # Must match the queue of the webhook
 
 # Input JSON Data
 USER_DATA='[